@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// a group with these channels picks its channels from what an existing file leaves free
+//
+// auto:      the channels no track uses, or the least used channel if every channel is used
+// auto-port: the channels no track uses on the first port with free channels (ff 21 port events)
+const (
+	autoChannels     = "auto"
+	autoPortChannels = "auto-port"
+)
+
+func isAutoChannels(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return s == autoChannels || s == autoPortChannels
+}
+
+func hasAutoChannels(groups []TrackGroup) bool {
+	for _, g := range groups {
+		if isAutoChannels(g.Channels) {
+			return true
+		}
+	}
+	return false
+}
+
+// channelUsage counts the channel events of every channel (1-16) of every port
+type channelUsage [][17]int
+
+func (u channelUsage) count(port int, channel int) int {
+	if port >= len(u) {
+		return 0
+	}
+	return u[port][channel]
+}
+
+// readChannelUsage streams the file counting the channel events on every port and channel
+// a track is on port 0 until it has a midi port event
+func readChannelUsage(path string) (channelUsage, error) {
+	usage := make(channelUsage, 1)
+
+	err := streamTracks(path, func(header midiHeader, index int, track io.ByteReader) error {
+		port := 0
+
+		er := newEventReader(track)
+		for {
+			ev, err := er.next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if ev.status == 0xff && ev.meta == 0x21 && len(ev.data) == 1 {
+				port = int(ev.data[0])
+				for len(usage) <= port {
+					usage = append(usage, [17]int{})
+				}
+			}
+			if ev.isChannelEvent() {
+				usage[port][ev.channel()]++
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// resolveAutoChannels returns a copy of the groups with auto channels replaced by the channels
+// picked from the usage, free channels are shared between the auto groups in order
+// usage can be nil for a new file, then every channel is free
+func resolveAutoChannels(groups []TrackGroup, usage channelUsage, logger *Logger) []TrackGroup {
+	resolved := append([]TrackGroup{}, groups...)
+	taken := map[[2]int]int{} // port and channel to tracks placed there by earlier groups
+
+	remaining := 0
+	for _, g := range groups {
+		if isAutoChannels(g.Channels) {
+			remaining++
+		}
+	}
+
+	for i, g := range resolved {
+		if !isAutoChannels(g.Channels) {
+			continue
+		}
+		remaining--
+
+		var candidates []int
+		for ch := 1; ch <= 16; ch++ {
+			if ch != 10 || g.allowsDrumChannel() {
+				candidates = append(candidates, ch)
+			}
+		}
+
+		lastPort := 0
+		if strings.EqualFold(strings.TrimSpace(g.Channels), autoPortChannels) {
+			lastPort = 255
+		}
+
+		var free []int
+		port := 0
+		for ; port <= lastPort; port++ {
+			free = free[:0]
+			for _, ch := range candidates {
+				if usage.count(port, ch) == 0 && taken[[2]int{port, ch}] == 0 {
+					free = append(free, ch)
+				}
+			}
+			if len(free) > 0 {
+				break
+			}
+		}
+
+		if len(free) == 0 {
+			// every channel is used, take the one with the fewest events on port 0
+			port = 0
+			sort.SliceStable(candidates, func(a, b int) bool {
+				return usage.count(0, candidates[a])+taken[[2]int{0, candidates[a]}] < usage.count(0, candidates[b])+taken[[2]int{0, candidates[b]}]
+			})
+			free = candidates[:1]
+			logger.With(groupField(g.Name)).Warnf("no free channels, using the least used channel %v (%v events)", free[0], usage.count(0, free[0]))
+		} else {
+			// leave some free channels for the auto groups after this one
+			n := len(free) / (remaining + 1)
+			if n < 1 {
+				n = 1
+			}
+			if n > g.Count && g.Count > 0 {
+				n = g.Count
+			}
+			free = free[:n]
+			if port > 0 {
+				logger.With(groupField(g.Name)).Infof("auto channels: %v on port %v (port 0 has no free channels)", joinInts(free), port)
+			} else {
+				logger.With(groupField(g.Name)).Infof("auto channels: %v (unused in the file)", joinInts(free))
+			}
+		}
+
+		for _, ch := range free {
+			taken[[2]int{port, ch}] += g.Count
+		}
+
+		resolved[i].Channels = joinInts(free)
+		resolved[i].Port = port
+		logger.Debugf("group %v: auto channels resolved to %v on port %v", g.Name, resolved[i].Channels, port)
+	}
+
+	return resolved
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+// cliCommand is a command that can be run without the GUI
+// e.g. `empty-track-creator remove -last 8 song.mid`
+type cliCommand struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var cliCommands = []cliCommand{
+	{"create", "create empty tracks in a new or existing file", runCreateCommand},
+	{"remove", "remove tracks by index, name pattern or the last N tracks", runRemoveCommand},
+	{"purge", "remove every track that has no notes", runPurgeCommand},
+	{"merge", "combine the tracks of several files into one file", runMergeCommand},
+	{"split", "split a file into several files by track ranges, channel or name", runSplitCommand},
+	{"concat", "join several files end to end in time", runConcatCommand},
+	{"resample", "change the resolution (ppq) of a file", runResampleCommand},
+	{"compact", "rewrite a file using running status to make it smaller", runCompactCommand},
+	{"remap", "move the events of a channel to another channel or port", runRemapCommand},
+	{"conductor", "show or change the tempo and time signature events of a file", runConductorCommand},
+	{"inspect", "describe the header and every track of a file", runInspectCommand},
+	{"stats", "count notes, max notes per second and peak polyphony", runStatsCommand},
+}
+
+func findCLICommand(name string) *cliCommand {
+	for i := range cliCommands {
+		if cliCommands[i].name == name {
+			return &cliCommands[i]
+		}
+	}
+
+	return nil
+}
+
+// runCLI runs the command in args[0] and returns the exit code
+func runCLI(args []string) int {
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printCLIUsage()
+		return 0
+	}
+
+	cmd := findCLICommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %v\n", args[0])
+		printCLIUsage()
+		return 2
+	}
+
+	setCLILogLevel = appLog.AddSink(LevelInfo, newConsoleSink(os.Stdout, os.Stderr))
+	defer func() {
+		for _, sink := range cliLogFiles {
+			sink.Close()
+		}
+	}()
+
+	err := cmd.run(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		appLog.Debugf("%v failed: %v", cmd.name, err)
+		fmt.Fprintf(os.Stderr, "%v: %v\n", cmd.name, err)
+		return exitCode(err)
+	}
+
+	return 0
+}
+
+func printCLIUsage() {
+	fmt.Fprintln(os.Stderr, "usage: empty-track-creator [command] [flags] [files]")
+	fmt.Fprintln(os.Stderr, "run without a command to open the GUI")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(os.Stderr, "  %-10v %v\n", cmd.name, cmd.usage)
+	}
+}
+
+// the cli prints info and up (see consoleSink), every command has flags to change that
+var (
+	setCLILogLevel = func(Level) {}
+	cliLogFiles    []*fileSink
+)
+
+// levelFlag is a bool flag that sets the cli log level, e.g. -v
+type levelFlag Level
+
+func (f levelFlag) String() string   { return "" }
+func (f levelFlag) IsBoolFlag() bool { return true }
+
+func (f levelFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if on {
+		setCLILogLevel(Level(f))
+	}
+	return err
+}
+
+func addLogFlags(fs *flag.FlagSet) {
+	fs.Var(levelFlag(LevelDebug), "v", "print debug lines too")
+	fs.Var(levelFlag(LevelWarn), "quiet", "only print warnings and errors")
+	fs.Func("log-level", "the lowest level printed: "+strings.Join(logLevels, ", "), func(s string) error {
+		level, err := parseLevel(s)
+		if err != nil {
+			return err
+		}
+		setCLILogLevel(level)
+		return nil
+	})
+	fs.Func("log-file", "also append every line, debug included, to this file", func(path string) error {
+		sink, err := newFileSink(path)
+		if err != nil {
+			return err
+		}
+		appLog.AddSink(LevelDebug, sink)
+		cliLogFiles = append(cliLogFiles, sink)
+		return nil
+	})
+}
+
+func newFlagSet(name string, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: empty-track-creator %v %v\n", name, usage)
+		fs.PrintDefaults()
+	}
+	addLogFlags(fs)
+
+	return fs
+}
+
+func runCreateCommand(args []string) error {
+	fs := newFlagSet("create", "[flags] file.mid")
+	groupsPath := fs.String("groups", "", "a JSON file with the track groups (default: 8 melody and 8 art tracks)")
+	order := fs.String("order", "grouped", "track order: "+strings.Join(trackOrders, ", "))
+	pattern := fs.String("pattern", "", "group names for the custom order, e.g. Melody,Melody,Art")
+	ppq := fs.Int("ppq", 960, "resolution of a new file")
+	bpm := fs.Int("bpm", 138, "tempo of a new file")
+	insert := fs.String("insert", "end", "where tracks go in an existing file: "+strings.Join(insertModes, ", "))
+	insertAt := fs.Int("insert-at", 0, "the track index or channel for after-track and after-channel")
+	dryRun := fs.Bool("dry-run", false, "only show the tracks that would be created")
+	asJSON := fs.Bool("json", false, "print the dry run as JSON")
+	planPath := fs.String("plan", "", "write the tracks of a JSON plan (e.g. an edited -dry-run -json) instead of the groups")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 output file, got %v", fs.NArg())
+	}
+
+	groups := defaultTrackGroups()
+	if *groupsPath != "" {
+		data, err := os.ReadFile(*groupsPath)
+		if err != nil {
+			return ioError("read", *groupsPath, err)
+		}
+		if groups, err = decodeTrackGroups(string(data)); err != nil {
+			return fmt.Errorf("%v: %w", *groupsPath, err)
+		}
+	}
+
+	opts := CreateOptions{
+		Path:      fs.Arg(0),
+		Groups:    groups,
+		Order:     TrackOrder{Mode: *order, Pattern: *pattern},
+		PPQ:       *ppq,
+		BPM:       *bpm,
+		Insert:    InsertPosition{Mode: *insert, Value: *insertAt},
+		Conductor: ConductorOptions{Mode: "keep"},
+	}
+
+	if *dryRun {
+		plan, err := PlanMIDI(opts, nil)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(plan)
+		}
+		return plan.writeTable(os.Stdout)
+	}
+
+	// ctrl+c stops creating and leaves the file as it was
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *planPath != "" {
+		data, err := os.ReadFile(*planPath)
+		if err != nil {
+			return ioError("read", *planPath, err)
+		}
+		var plan TrackPlan
+		if err := json.Unmarshal(data, &plan); err != nil {
+			return fmt.Errorf("%v: %w", *planPath, err)
+		}
+		// the plan knows where its tracks go
+		opts.Insert = plan.Insert
+		return WritePlan(ctx, &plan, opts, appLog)
+	}
+
+	return CreateMIDI(ctx, opts, appLog)
+}
+
+func runRemoveCommand(args []string) error {
+	fs := newFlagSet("remove", "[flags] file.mid")
+	indexes := fs.String("indexes", "", "track indexes to remove, e.g. 1,3,5-8 (0 is the first track)")
+	name := fs.String("name", "", "remove tracks whose name matches this glob pattern, e.g. \"Art*\"")
+	last := fs.Int("last", 0, "remove the last N tracks")
+	out := fs.String("out", "", "output path (default: overwrite the input file)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+
+	opts := RemoveOptions{NamePattern: *name, Last: *last}
+	if strings.TrimSpace(*indexes) != "" {
+		list, err := parseIndexList(*indexes)
+		if err != nil {
+			return err
+		}
+		opts.Indexes = list
+	}
+
+	input := fs.Arg(0)
+	output := *out
+	if output == "" {
+		output = input
+	}
+
+	return RemoveMIDITracks(input, output, opts, appLog)
+}
+
+func runPurgeCommand(args []string) error {
+	fs := newFlagSet("purge", "[flags] file.mid")
+	keepControl := fs.Bool("keep-control", false, "keep tracks without notes that have controller, sysex or meta events")
+	out := fs.String("out", "", "output path (default: overwrite the input file)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+
+	input := fs.Arg(0)
+	output := *out
+	if output == "" {
+		output = input
+	}
+
+	return PurgeEmptyTracks(input, output, PurgeOptions{KeepControlTracks: *keepControl}, appLog)
+}
+
+func runMergeCommand(args []string) error {
+	fs := newFlagSet("merge", "-out merged.mid [flags] a.mid b.mid ...")
+	out := fs.String("out", "", "output path")
+	ppq := fs.Int("ppq", 0, "resolution of the merged file (default: the first file's)")
+	conductor := fs.String("conductor", "1", "which file's conductor track to keep (1 is the first file), or \"merge\" to combine them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		fs.Usage()
+		return errors.New("-out is required")
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return fmt.Errorf("expected at least 2 input files, got %v", fs.NArg())
+	}
+
+	opts := MergeOptions{PPQ: *ppq, Conductor: -1}
+	if *conductor != "merge" {
+		n, err := strconv.Atoi(*conductor)
+		if err != nil {
+			return fmt.Errorf("conductor must be a file number or \"merge\"")
+		}
+		opts.Conductor = n - 1
+	}
+
+	return MergeMIDIFiles(fs.Args(), *out, opts, appLog)
+}
+
+func runSplitCommand(args []string) error {
+	fs := newFlagSet("split", "-by ranges|channel|name [flags] file.mid")
+	by := fs.String("by", "channel", "how to split the file: ranges, channel or name")
+	ranges := fs.String("ranges", "", "track index ranges for -by ranges, one file each, e.g. 1-4,5-8")
+	names := fs.String("names", "", "track name patterns for -by name, one file each, e.g. \"Melody*,Art*\"")
+	outDir := fs.String("out-dir", "", "folder for the output files (default: next to the input file)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+
+	opts := SplitOptions{Mode: *by}
+	switch *by {
+	case "ranges":
+		opts.Value = *ranges
+	case "name":
+		opts.Value = *names
+	}
+
+	return SplitMIDIFile(fs.Arg(0), *outDir, opts, appLog)
+}
+
+func runResampleCommand(args []string) error {
+	fs := newFlagSet("resample", "-ppq N [flags] file.mid")
+	ppq := fs.Int("ppq", 0, "new resolution")
+	rounding := fs.String("round", "nearest", "how ticks between two new ticks are rounded: nearest, down or up")
+	minLength := fs.Int("min-length", 0, "make every note at least this many ticks (at the new ppq) long")
+	out := fs.String("out", "", "output path (default: overwrite the input file)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+
+	input := fs.Arg(0)
+	output := *out
+	if output == "" {
+		output = input
+	}
+
+	return ResampleMIDIFile(input, output, ResampleOptions{PPQ: *ppq, Rounding: *rounding, MinNoteLength: *minLength}, appLog)
+}
+
+func runCompactCommand(args []string) error {
+	fs := newFlagSet("compact", "[flags] file.mid")
+	expand := fs.Bool("expand", false, "write every status byte instead, for programs that do not read running status")
+	out := fs.String("out", "", "output path (default: overwrite the input file)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+
+	input := fs.Arg(0)
+	output := *out
+	if output == "" {
+		output = input
+	}
+
+	return CompactMIDIFile(input, output, !*expand, appLog)
+}
+
+func runRemapCommand(args []string) error {
+	fs := newFlagSet("remap", "-map from:to[@port][/tracks] [flags] file.mid")
+	var rules []ChannelRule
+	fs.Func("map", "a channel rule, e.g. 16:14, 1:2@1 (also set port 1) or 10:11/3,5-8 (only tracks 3 and 5-8), can be repeated", func(s string) error {
+		rule, err := parseChannelRule(s)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+		return nil
+	})
+	dryRun := fs.Bool("dry-run", false, "only show what would be moved")
+	out := fs.String("out", "", "output path (default: overwrite the input file)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+
+	input := fs.Arg(0)
+	output := *out
+	if output == "" {
+		output = input
+	}
+
+	return RemapChannels(input, output, RemapOptions{Rules: rules, DryRun: *dryRun}, appLog)
+}
+
+func runConductorCommand(args []string) error {
+	fs := newFlagSet("conductor", "[flags] file.mid")
+	bpm := fs.Int("bpm", 0, "replace every tempo change of the conductor track with this tempo")
+	importPath := fs.String("import", "", "replace the tempo and time signatures with the ones of this file")
+	sigs := fs.String("time-sig", "", "time signatures to add as bar:numerator/denominator, e.g. 1:4/4,17:3/4")
+	out := fs.String("out", "", "output path (default: overwrite the input file)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+	if *bpm != 0 && *importPath != "" {
+		return errors.New("-bpm and -import can not be used together")
+	}
+
+	input := fs.Arg(0)
+	opts := ConductorOptions{Mode: "keep", BPM: *bpm, ImportPath: *importPath}
+	switch {
+	case *bpm != 0:
+		if err := validateBPM(*bpm); err != nil {
+			return err
+		}
+		opts.Mode = "set-tempo"
+	case *importPath != "":
+		opts.Mode = "import"
+	}
+	var err error
+	if opts.TimeSignatures, err = parseTimeSignatures(*sigs); err != nil {
+		return err
+	}
+
+	// without changes the current tempo events are listed
+	if !opts.changesConductor() {
+		lines, err := describeTempoEvents(input)
+		if err != nil {
+			return err
+		}
+		fmt.Println(formatTempoEvents(lines))
+		return nil
+	}
+
+	output := *out
+	if output == "" {
+		output = input
+	}
+
+	return RewriteConductor(input, output, opts, appLog)
+}
+
+func runConcatCommand(args []string) error {
+	fs := newFlagSet("concat", "-out song.mid [flags] part1.mid part2.mid ...")
+	out := fs.String("out", "", "output path")
+	ppq := fs.Int("ppq", 0, "resolution of the output (default: the first file's)")
+	align := fs.String("align", "index", "how tracks are matched between files: index or name")
+	bars := fs.String("at-bars", "", "the bar each file after the first starts on, e.g. 17,33 (default: where the previous file ends)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		fs.Usage()
+		return errors.New("-out is required")
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return fmt.Errorf("expected at least 2 input files, got %v", fs.NArg())
+	}
+
+	opts := ConcatOptions{PPQ: *ppq, Align: *align}
+	for _, bar := range strings.Split(*bars, ",") {
+		if bar = strings.TrimSpace(bar); bar == "" {
+			continue
+		}
+		n, err := strconv.Atoi(bar)
+		if err != nil {
+			return fmt.Errorf("bar %v is not a number", bar)
+		}
+		opts.StartBars = append(opts.StartBars, n)
+	}
+
+	return ConcatMIDIFiles(fs.Args(), *out, opts, appLog)
+}
+
+func runInspectCommand(args []string) error {
+	fs := newFlagSet("inspect", "[-json] file.mid")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+
+	report, err := InspectMIDIFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	return report.writeTable(os.Stdout)
+}
+
+func runStatsCommand(args []string) error {
+	fs := newFlagSet("stats", "[-json] file.mid")
+	asJSON := fs.Bool("json", false, "print the statistics as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected 1 input file, got %v", fs.NArg())
+	}
+
+	stats, err := AnalyzeMIDIFile(fs.Arg(0), appLog)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	return stats.writeTable(os.Stdout)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+)
+
+// how the tracks of the next file are matched with the tracks so far
+//
+// index: track n of every file goes into track n
+// name:  tracks with the same name are joined, other tracks are added as new tracks
+var concatAlignModes = []string{"index", "name"}
+
+type ConcatOptions struct {
+	PPQ   int    // resolution of the output, 0 uses the first file's
+	Align string // index or name
+
+	// the bar (starting at 1) each file after the first starts on
+	// empty means every file starts where the previous one ends
+	StartBars []int
+
+	RunningStatus bool // leave out repeated status bytes in the joined tracks
+}
+
+// the tick that the last event (or end of track) of any track is on
+func endTick(tracks [][]timedEvent) uint64 {
+	var end uint64
+	for _, events := range tracks {
+		for _, ev := range events {
+			if ev.tick > end {
+				end = ev.tick
+			}
+		}
+	}
+
+	return end
+}
+
+func hasEventAtStart(events []timedEvent, meta byte) bool {
+	for _, ev := range events {
+		if ev.tick > 0 {
+			return false
+		}
+		if ev.status == 0xff && ev.meta == meta {
+			return true
+		}
+	}
+
+	return false
+}
+
+func shiftEvents(events []timedEvent, offset uint64) {
+	for i := range events {
+		events[i].tick += offset
+	}
+}
+
+// withoutTrackName drops the track name events, used when joining into a track that already has one
+func withoutTrackName(events []timedEvent) []timedEvent {
+	var kept []timedEvent
+	for _, ev := range events {
+		if !(ev.status == 0xff && ev.meta == 0x03) {
+			kept = append(kept, ev)
+		}
+	}
+
+	return kept
+}
+
+func eventsTrackName(events []timedEvent) string {
+	for _, ev := range events {
+		if ev.status == 0xff && ev.meta == 0x03 {
+			return string(ev.data)
+		}
+	}
+
+	return ""
+}
+
+func concatFiles(files []*midiFile, opts ConcatOptions, logger *Logger) (*midiFile, error) {
+	if len(files) < 2 {
+		return nil, fmt.Errorf("at least 2 files are needed")
+	}
+	if len(opts.StartBars) > 0 && len(opts.StartBars) != len(files)-1 {
+		return nil, fmt.Errorf("expected %v start bars (one for each file after the first), got %v", len(files)-1, len(opts.StartBars))
+	}
+	if opts.Align != "" && opts.Align != "index" && opts.Align != "name" {
+		return nil, fmt.Errorf("unknown align mode %v", opts.Align)
+	}
+
+	ppq := opts.PPQ
+	if ppq == 0 {
+		ppq = files[0].header.division
+	} else if err := validatePPQ(ppq); err != nil {
+		return nil, fmt.Errorf("%w (or 0 for the first file's)", err)
+	}
+
+	var out [][]timedEvent
+	for k, file := range files {
+		var tracks [][]timedEvent
+		for i, track := range file.tracks {
+			events, err := decodeTrack(track)
+			if err != nil {
+				return nil, fmt.Errorf("file %v track %v: %w", k+1, i, err)
+			}
+			rescaleEvents(events, file.header.division, ppq)
+			tracks = append(tracks, events)
+		}
+
+		if k == 0 {
+			out = tracks
+			continue
+		}
+
+		// where this file starts
+		offset := endTick(out)
+		if len(opts.StartBars) > 0 {
+			bar := opts.StartBars[k-1]
+			if bar < 1 {
+				return nil, fmt.Errorf("bar %v is not valid, bars start at 1", bar)
+			}
+			start := tempoMapFromEvents(ppq, out[0]).BarBeatToTick(BarBeat{Bar: bar})
+			if start < offset {
+				logger.Warnf("file %v: bar %v is before the end of the previous files, the files will overlap", k+1, bar)
+			}
+			offset = start
+		}
+		logger.Infof("file %v: starting at tick %v", k+1, offset)
+
+		// the conductor is joined with the first track, keeping the tempo and time signature of this
+		// file from leaking in from the previous one
+		conductor := withoutTrackName(tracks[0])
+		if !hasEventAtStart(conductor, 0x51) {
+			conductor = append([]timedEvent{{midiEvent: midiEvent{status: 0xff, meta: 0x51, data: NumberToBytes(500_000, 3)}}}, conductor...)
+		}
+		if !hasEventAtStart(conductor, 0x58) {
+			conductor = append([]timedEvent{{midiEvent: midiEvent{status: 0xff, meta: 0x58, data: []byte{4, 2, 24, 8}}}}, conductor...)
+		}
+		shiftEvents(conductor, offset)
+		out[0] = append(out[0], conductor...)
+
+		used := make([]bool, len(out))
+		for i, events := range tracks[1:] {
+			shiftEvents(events, offset)
+
+			target := -1
+			if opts.Align == "name" {
+				name := eventsTrackName(events)
+				for j := 1; j < len(out); j++ {
+					if !used[j] && eventsTrackName(out[j]) == name {
+						target = j
+						break
+					}
+				}
+			} else if i+1 < len(out) {
+				target = i + 1
+			}
+
+			if target == -1 {
+				logger.Debugf("file %v track %v: no matching track, adding a new one", k+1, i+1)
+				out = append(out, events)
+				used = append(used, true)
+				continue
+			}
+
+			used[target] = true
+			out[target] = append(out[target], withoutTrackName(events)...)
+		}
+
+		if len(out) > maxTracks {
+			return nil, &TrackLimitError{Count: len(out)}
+		}
+		logger.Infof("file %v: joined %v tracks, output has %v tracks", k+1, len(tracks)-1, len(out))
+	}
+
+	result := &midiFile{header: midiHeader{format: 1, division: ppq}}
+	for _, events := range out {
+		sortEvents(events)
+		result.tracks = append(result.tracks, encodeTrack(events, opts.RunningStatus))
+	}
+
+	return result, nil
+}
+
+// ConcatMIDIFiles joins files end to end in time, the first file is at the start of the output
+func ConcatMIDIFiles(inputPaths []string, outputPath string, opts ConcatOptions, logger *Logger) error {
+	files, err := readMergeInputs(inputPaths)
+	if err != nil {
+		return err
+	}
+
+	result, err := concatFiles(files, opts, logger)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("writing %v tracks at %v ppq to %v", len(result.tracks), result.header.division, outputPath)
+	return result.save(outputPath)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// what happens to the tempo events of an existing file's conductor (first) track
+//
+// keep:      leave them as they are (the default)
+// set-tempo: replace every tempo change with one tempo at the start
+// import:    replace the tempo and time signature events with the ones of another file
+var conductorModes = []string{"keep", "set-tempo", "import"}
+
+type ConductorOptions struct {
+	Mode       string
+	BPM        int    // used by set-tempo
+	ImportPath string // used by import, every track of that file is read for tempo and time signature events
+
+	// time signatures added after the mode is applied, replacing any already on that bar
+	TimeSignatures []BarTimeSignature
+
+	RunningStatus bool // leave out repeated status bytes in the rewritten track
+}
+
+// BarTimeSignature is a time signature placed by bar, its Tick is ignored
+type BarTimeSignature struct {
+	Bar int
+	TimeSignature
+}
+
+// changesConductor tells if the options change the conductor track at all
+func (c ConductorOptions) changesConductor() bool {
+	return (c.Mode != "" && c.Mode != "keep") || len(c.TimeSignatures) > 0
+}
+
+// parseTimeSignatures parses a list like "1:4/4,17:3/4" of bar:numerator/denominator
+func parseTimeSignatures(s string) ([]BarTimeSignature, error) {
+	var sigs []BarTimeSignature
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bar, sig, ok := strings.Cut(part, ":")
+		num, den, ok2 := strings.Cut(sig, "/")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("%q is not bar:numerator/denominator", part)
+		}
+
+		b, err := strconv.Atoi(strings.TrimSpace(bar))
+		if err != nil || b < 1 {
+			return nil, fmt.Errorf("%q: bar must be a number from 1", part)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(num))
+		if err != nil || n < 1 || n > 255 {
+			return nil, fmt.Errorf("%q: numerator must be between 1 and 255", part)
+		}
+		d, err := strconv.Atoi(strings.TrimSpace(den))
+		if err != nil || d < 1 || d > 128 || d&(d-1) != 0 {
+			return nil, fmt.Errorf("%q: denominator must be a power of 2 up to 128", part)
+		}
+
+		sigs = append(sigs, BarTimeSignature{Bar: b, TimeSignature: TimeSignature{Numerator: n, Denominator: d}})
+	}
+
+	return sigs, nil
+}
+
+func tempoEvent(tick uint64, usPerQuarter int) timedEvent {
+	return timedEvent{tick: tick, midiEvent: midiEvent{status: 0xff, meta: 0x51, data: NumberToBytes(usPerQuarter, 3)}}
+}
+
+func timeSignatureEvent(tick uint64, numerator int, denominator int) timedEvent {
+	power := 0
+	for 1<<power < denominator {
+		power++
+	}
+
+	// 24 midi clocks per metronome click, 8 32nd notes per quarter
+	return timedEvent{tick: tick, midiEvent: midiEvent{status: 0xff, meta: 0x58, data: []byte{byte(numerator), byte(power), 24, 8}}}
+}
+
+func isTempoOrTimeSignature(ev midiEvent) bool {
+	return ev.status == 0xff && (ev.meta == 0x51 || ev.meta == 0x58)
+}
+
+// importTempoEvents reads the tempo and time signature events of every track of a file
+func importTempoEvents(path string, ppq int) ([]timedEvent, error) {
+	file, err := readMIDIFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	if err := checkDivision(path, file.header); err != nil {
+		return nil, err
+	}
+
+	var imported []timedEvent
+	for i, track := range file.tracks {
+		events, err := decodeTrack(track)
+		if err != nil {
+			return nil, fmt.Errorf("%v track %v: %w", path, i, err)
+		}
+		for _, ev := range events {
+			if isTempoOrTimeSignature(ev.midiEvent) {
+				imported = append(imported, ev)
+			}
+		}
+	}
+	rescaleEvents(imported, file.header.division, ppq)
+
+	return imported, nil
+}
+
+// rewriteConductor changes the tempo events of the file's first track
+func rewriteConductor(file *midiFile, opts ConductorOptions, logger *Logger) error {
+	if !opts.changesConductor() {
+		return nil
+	}
+	if len(file.tracks) == 0 {
+		return errors.New("file has no conductor track")
+	}
+	if err := checkDivision("file", file.header); err != nil {
+		return err
+	}
+
+	ppq := file.header.division
+	events, err := decodeTrack(file.tracks[0])
+	if err != nil {
+		return fmt.Errorf("conductor: %w", err)
+	}
+
+	switch opts.Mode {
+	case "", "keep":
+	case "set-tempo":
+		if err := validateBPM(opts.BPM); err != nil {
+			return err
+		}
+
+		var kept []timedEvent
+		removed := 0
+		for _, ev := range events {
+			if _, ok := tempoFromEvent(ev.midiEvent); ok {
+				removed++
+				continue
+			}
+			kept = append(kept, ev)
+		}
+		events = append([]timedEvent{tempoEvent(0, 60_000_000/opts.BPM)}, kept...)
+		logger.Infof("replaced %v tempo events with %v bpm", removed, opts.BPM)
+	case "import":
+		imported, err := importTempoEvents(opts.ImportPath, ppq)
+		if err != nil {
+			return err
+		}
+
+		var kept []timedEvent
+		for _, ev := range events {
+			if !isTempoOrTimeSignature(ev.midiEvent) {
+				kept = append(kept, ev)
+			}
+		}
+		events = append(kept, imported...)
+		logger.Infof("imported %v tempo and time signature events from %v", len(imported), opts.ImportPath)
+	default:
+		return fmt.Errorf("unknown conductor mode %v", opts.Mode)
+	}
+
+	sortEvents(events)
+
+	// every time signature is placed using the bars of the ones before it
+	for _, sig := range opts.TimeSignatures {
+		tick := tempoMapFromEvents(ppq, events).BarBeatToTick(BarBeat{Bar: sig.Bar})
+
+		var kept []timedEvent
+		for _, ev := range events {
+			if _, _, ok := timeSignatureFromEvent(ev.midiEvent); ok && ev.tick == tick {
+				continue
+			}
+			kept = append(kept, ev)
+		}
+		events = append(kept, timeSignatureEvent(tick, sig.Numerator, sig.Denominator))
+		sortEvents(events)
+
+		logger.Infof("set time signature %v/%v at bar %v (tick %v)", sig.Numerator, sig.Denominator, sig.Bar, tick)
+	}
+
+	file.tracks[0] = encodeTrack(events, opts.RunningStatus)
+	return nil
+}
+
+// describeTempoEvents lists the tempo and time signature events of a file, one per line
+func describeTempoEvents(path string) ([]string, error) {
+	tempo, err := ReadTempoMap(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	err = streamTracks(path, func(header midiHeader, index int, track io.ByteReader) error {
+		var tick uint64
+		er := newEventReader(track)
+		for {
+			ev, err := er.next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			tick += uint64(ev.delta)
+			line := fmt.Sprintf("track %v, %v (%.2fs): ", index, tempo.TickToBarBeat(tick), tempo.TickToSeconds(tick))
+			if us, ok := tempoFromEvent(ev); ok {
+				lines = append(lines, line+fmt.Sprintf("tempo %.2f bpm", 60_000_000/float64(us)))
+			}
+			if num, den, ok := timeSignatureFromEvent(ev); ok {
+				lines = append(lines, line+fmt.Sprintf("time signature %v/%v", num, den))
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// RewriteConductor changes the tempo events of an existing file
+func RewriteConductor(inputPath string, outputPath string, opts ConductorOptions, logger *Logger) error {
+	file, err := readMIDIFile(inputPath)
+	if err != nil {
+		return err
+	}
+	if err := rewriteConductor(file, opts, logger); err != nil {
+		return err
+	}
+
+	return file.save(outputPath)
+}
+
+// formatTempoEvents joins the lines of describeTempoEvents, for showing in a dialog or the terminal
+func formatTempoEvents(lines []string) string {
+	if len(lines) == 0 {
+		return "no tempo or time signature events, the file plays at 120 bpm in 4/4"
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// CreateOptions is everything needed to create the tracks of the groups in a file
+type CreateOptions struct {
+	Path   string
+	Groups []TrackGroup
+	Order  TrackOrder
+
+	// only used for new files
+	PPQ int
+	BPM int
+
+	// only used when the file already exists
+	Insert    InsertPosition
+	Conductor ConductorOptions
+
+	// leave out repeated status bytes in the new tracks (and a rewritten conductor track)
+	RunningStatus bool
+
+	// called as tracks are created and bytes are written, may be nil
+	Progress func(CreateProgress)
+}
+
+// CreateProgress is how far a CreateMIDI call has got
+type CreateProgress struct {
+	Tracks      int // tracks created
+	TotalTracks int
+	Written     int64 // bytes written to the file
+	TotalBytes  int64 // 0 until writing starts
+}
+
+// Fraction is the progress from 0 to 1, creating the tracks is the first half and writing them the second
+func (p CreateProgress) Fraction() float64 {
+	var f float64
+	if p.TotalTracks > 0 {
+		f += 0.5 * float64(p.Tracks) / float64(p.TotalTracks)
+	}
+	if p.TotalBytes > 0 {
+		f += 0.5 * float64(p.Written) / float64(p.TotalBytes)
+	}
+	return f
+}
+
+func (p CreateProgress) String() string {
+	if p.TotalBytes == 0 {
+		return fmt.Sprintf("%v of %v tracks created", p.Tracks, p.TotalTracks)
+	}
+	return fmt.Sprintf("%v of %v written", formatBytes(p.Written), formatBytes(p.TotalBytes))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%v bytes", n)
+	}
+}
+
+func (o CreateOptions) validate() error {
+	if err := validateTrackGroups(o.Groups); err != nil {
+		return fmt.Errorf("track groups: %w", err)
+	}
+	if totalTrackCount(o.Groups) == 0 {
+		return errors.New("track groups: no tracks to create")
+	}
+
+	return o.validateOutput()
+}
+
+// validateOutput checks the options that are used when writing, not planning
+func (o CreateOptions) validateOutput() error {
+	if o.Path == "" {
+		return errors.New("output path cannot be empty")
+	}
+	if err := validatePPQ(o.PPQ); err != nil {
+		return err
+	}
+	return validateBPM(o.BPM)
+}
+
+// validateBPM checks a tempo can be written,
+// it is written in 3 bytes as microseconds per quarter note so 3 bpm or less does not fit
+func validateBPM(bpm int) error {
+	if bpm < 4 || bpm > 65535 {
+		return errors.New("bpm must be between 4 and 65535")
+	}
+
+	return nil
+}
+
+// CreateMIDI creates the tracks of the groups and writes them to a new file,
+// or adds them to the file if it already exists
+// cancelling ctx stops it and leaves the file as it was
+func CreateMIDI(ctx context.Context, opts CreateOptions, logger *Logger) error {
+	plan, err := PlanMIDI(opts, logger)
+	if err != nil {
+		return err
+	}
+
+	return WritePlan(ctx, plan, opts, logger)
+}
+
+// WritePlan writes the tracks of a plan, which may have been edited since PlanMIDI made it
+// the groups and order of opts are not used, the other options are
+func WritePlan(ctx context.Context, plan *TrackPlan, opts CreateOptions, logger *Logger) error {
+	if err := opts.validateOutput(); err != nil {
+		return err
+	}
+	if err := plan.validate(); err != nil {
+		return err
+	}
+	if err := checkPlanFile(plan, opts); err != nil {
+		return err
+	}
+
+	progress := CreateProgress{TotalTracks: len(plan.Tracks)}
+	report := func() {
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+	report()
+
+	tracks, err := createTracks(ctx, plan, opts.RunningStatus, func(done int) {
+		progress.Tracks = done
+		report()
+	})
+	if err != nil {
+		return err
+	}
+	logger.Debugf("created tracks")
+
+	conductor := opts.Conductor
+	conductor.BPM = opts.BPM
+	conductor.RunningStatus = opts.RunningStatus
+
+	// the header counts every track, the conductor track of a new file is added by the writer
+	trackCount := len(plan.Tracks)
+	if !plan.NewFile {
+		trackCount += plan.ExistingTracks
+	}
+
+	return WriteMIDI(ctx, MIDIInfo{
+		tracks:     tracks,
+		trackCount: trackCount,
+		midiPath:   opts.Path,
+		ppq:        opts.PPQ,
+		bpm:        opts.BPM,
+		insert:     opts.Insert,
+		conductor:  conductor,
+		logger:     logger,
+		progress: func(written int64, total int64) {
+			progress.Written, progress.TotalBytes = written, total
+			report()
+		},
+	})
+}
+
+// checkPlanFile makes sure the plan was made for the file and options it is written with,
+// a plan for a file that has changed since would write the wrong track count
+func checkPlanFile(plan *TrackPlan, opts CreateOptions) error {
+	if plan.Path != opts.Path || plan.Insert != opts.Insert {
+		return errors.New("the output or insert position changed since the tracks were planned, plan them again")
+	}
+
+	_, err := os.Stat(opts.Path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return ioError("open", opts.Path, err)
+	}
+	existing := 0
+	if exists {
+		if existing, err = ReadMIDITracks(opts.Path, nil); err != nil {
+			return err
+		}
+	}
+	if plan.NewFile == exists || plan.ExistingTracks != existing {
+		return fmt.Errorf("%v changed since the tracks were planned, plan them again", opts.Path)
+	}
+
+	// edits can add tracks, so the limit is checked again
+	fileTracks := existing + len(plan.Tracks)
+	if !exists {
+		fileTracks++
+	}
+	if fileTracks > maxTracks {
+		return &TrackLimitError{Count: fileTracks}
+	}
+
+	return nil
+}
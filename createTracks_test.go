@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// groupTracks plans the tracks of the groups and creates them
+func groupTracks(t *testing.T, groups []TrackGroup, order TrackOrder, runningStatus bool) []byte {
+	t.Helper()
+
+	plan, err := planTracks(groups, order, nopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := createTracks(context.Background(), plan, runningStatus, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// randomGroups makes valid groups with random counts, channels and drum settings
+func randomGroups(r *rand.Rand) []TrackGroup {
+	var groups []TrackGroup
+	for i := 0; i < 1+r.Intn(4); i++ {
+		min := 1 + r.Intn(16)
+		max := min + r.Intn(17-min)
+		g := TrackGroup{
+			Name:       string(rune('A' + i)),
+			Count:      r.Intn(40),
+			Channels:   fmt.Sprintf("%v-%v", min, max),
+			Program:    r.Intn(128),
+			NameFormat: "{group}{n} {ch}",
+			AllowDrums: r.Intn(2) == 0,
+		}
+		if min == 10 && max == 10 {
+			g.AllowDrums = true
+		}
+		if r.Intn(5) == 0 {
+			g.Drums = true
+			g.DrumMode = drumModes[r.Intn(len(drumModes))]
+		}
+		groups = append(groups, g)
+	}
+
+	return groups
+}
+
+// the created tracks match the groups whatever the settings
+func TestCreateTracksProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for run := 0; run < 200; run++ {
+		groups := randomGroups(r)
+		if err := validateTrackGroups(groups); err != nil {
+			t.Fatalf("run %v: generated invalid groups: %v", run, err)
+		}
+		order := TrackOrder{Mode: trackOrders[r.Intn(3)]}
+		if totalTrackCount(groups) == 0 {
+			continue
+		}
+
+		data := groupTracks(t, groups, order, false)
+		tracks, err := splitTrackChunks(data)
+		if err != nil {
+			t.Fatalf("run %v: %v", run, err)
+		}
+		if len(tracks) != totalTrackCount(groups) {
+			t.Fatalf("run %v: got %v tracks, want %v", run, len(tracks), totalTrackCount(groups))
+		}
+
+		for i, track := range tracks {
+			events, err := decodeTrack(track)
+			if err != nil {
+				t.Fatalf("run %v track %v: %v", run, i, err)
+			}
+
+			channels, _ := trackChannels(track)
+			used := 0
+			for ch, ok := range channels {
+				if !ok {
+					continue
+				}
+				used++
+				if ch == 10 && !groupOfTrack(groups, events).allowsDrumChannel() {
+					t.Errorf("run %v track %v: on channel 10 without drums allowed", run, i)
+				}
+			}
+			if used != 1 {
+				t.Errorf("run %v track %v: uses %v channels, want 1", run, i, used)
+			}
+			if last := events[len(events)-1]; !last.isEndOfTrack() {
+				t.Errorf("run %v track %v: does not end with end of track", run, i)
+			}
+		}
+	}
+}
+
+// groupOfTrack finds the group from the track name, which starts with the group name
+func groupOfTrack(groups []TrackGroup, events []timedEvent) TrackGroup {
+	name := eventsTrackName(events)
+	for _, g := range groups {
+		if len(name) > 0 && name[:1] == g.Name {
+			return g
+		}
+	}
+
+	return TrackGroup{}
+}
+
+// auto groups pass the channels field and survive being saved and loaded
+func TestAutoChannelsGroup(t *testing.T) {
+	for _, channels := range []string{"auto", "auto-port", "AUTO"} {
+		if err := validateChannels(channels); err != nil {
+			t.Errorf("validateChannels(%q) = %v", channels, err)
+		}
+	}
+	if validateChannels("17") == nil || validateChannels("autox") == nil {
+		t.Error("invalid channels should be an error")
+	}
+
+	groups := []TrackGroup{{Name: "A", Count: 2, Channels: "auto", NameFormat: "{n}"}}
+	s, err := encodeTrackGroups(groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeTrackGroups(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || validateChannels(decoded[0].Channels) != nil || decoded[0].Validate() != nil {
+		t.Errorf("auto group did not round trip: %+v", decoded)
+	}
+}
+
+// moving a gm drum track off channel 10 drops the drum part, gs drums keep it
+func TestPlanSetChannelDrums(t *testing.T) {
+	groups := []TrackGroup{
+		{Name: "GM", Count: 1, Channels: "10", Drums: true, DrumMode: "gm"},
+		{Name: "GS", Count: 1, Channels: "11", Drums: true, DrumMode: "gs"},
+	}
+	plan, err := planTracks(groups, TrackOrder{}, nopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range plan.Tracks {
+		if err := plan.setChannel(i, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gm := plan.Tracks[0]; gm.Drums || gm.DrumMode != "" || len(gm.setup()) != 0 {
+		t.Errorf("gm track on channel 5 is still drums: %+v", gm)
+	}
+	if gs := plan.Tracks[1]; !gs.Drums || len(gs.setup()) == 0 {
+		t.Errorf("gs track on channel 5 lost its drum part: %+v", gs)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// drum modes decide how a drum group gets its channels
+// gm always uses channel 10, gs and xg can declare any channel
+// as a drum part with a sysex message at the start of the track
+var drumModes = []string{"gm", "gs", "xg"}
+
+// GM percussion parts, used to name the tracks of a drum group
+var gmPercussionNames = []string{
+	"Kick",
+	"Snare",
+	"Closed Hat",
+	"Open Hat",
+	"Pedal Hat",
+	"Clap",
+	"Rim",
+	"Low Tom",
+	"Mid Tom",
+	"High Tom",
+	"Crash",
+	"Ride",
+	"Splash",
+	"China",
+	"Tambourine",
+	"Cowbell",
+	"Shaker",
+	"Percussion",
+}
+
+// GS/GM2 drum kit programs
+var drumKits = map[int]string{
+	0:  "Standard",
+	8:  "Room",
+	16: "Power",
+	24: "Electronic",
+	25: "TR-808",
+	32: "Jazz",
+	40: "Brush",
+	48: "Orchestra",
+	56: "SFX",
+}
+
+func drumKitName(program int) string {
+	if name, ok := drumKits[program]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("kit %v", program)
+}
+
+func percussionName(n int) string {
+	return gmPercussionNames[(n-1)%len(gmPercussionNames)]
+}
+
+func validDrumMode(mode string) bool {
+	if mode == "" {
+		return true
+	}
+	for _, m := range drumModes {
+		if strings.EqualFold(m, mode) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gmDrumMode reports whether mode only has drums on channel 10,
+// gs and xg can turn any channel into a drum part
+func gmDrumMode(mode string) bool {
+	return mode == "" || strings.EqualFold(mode, "gm")
+}
+
+// drumPartSysex returns the sysex event (with a 0 delta time) that turns
+// the part on the given channel (1-16) into a drum part
+// channel 10 is already a drum part in every mode, so nothing is returned for it
+func drumPartSysex(mode string, channel int) []byte {
+	if channel == 10 {
+		return nil
+	}
+
+	var message []byte // everything after f0
+
+	switch strings.ToLower(mode) {
+	case "gs":
+		// f0 41 10 42 12 40 1x 15 vv cs f7
+		// 40 1x 15 is "use for rhythm part" of part block x
+		// block 0 is channel 10, then 1-9 and a-f for the others
+		block := channel
+		if channel > 10 {
+			block = channel - 1
+		}
+		// map 2, so the part can use a different kit than channel 10
+		data := []byte{0x40, byte(0x10 + block), 0x15, 0x02}
+
+		sum := 0
+		for _, b := range data {
+			sum += int(b)
+		}
+		checksum := byte((128 - sum%128) % 128)
+
+		message = append([]byte{0x41, 0x10, 0x42, 0x12}, data...)
+		message = append(message, checksum, 0xf7)
+	case "xg":
+		// f0 43 10 4c 08 pp 07 vv f7
+		// 08 pp 07 is the part mode of part pp, 1 is drum
+		message = []byte{0x43, 0x10, 0x4c, 0x08, byte(channel - 1), 0x07, 0x01, 0xf7}
+	default:
+		return nil
+	}
+
+	event := []byte{0x00, 0xf0}
+	event = append(event, GetVLQBytes(len(message))...)
+	event = append(event, message...)
+
+	return event
+}
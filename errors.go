@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// the errors that reading and writing files can return, so the gui can show
+// a message and the cli can exit with a code that says what went wrong
+
+// HeaderError means the file does not start with a valid MThd chunk
+type HeaderError struct {
+	Reason string
+}
+
+func (e *HeaderError) Error() string {
+	return "invalid MIDI header: " + e.Reason
+}
+
+// FormatError means the file is a MIDI format tracks can't be added to
+type FormatError struct {
+	Format int
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("MIDI format %v is not supported, only format 1 files have separate tracks", e.Format)
+}
+
+// TrackLimitError means a file would have more tracks than the header can hold
+type TrackLimitError struct {
+	Count int
+}
+
+func (e *TrackLimitError) Error() string {
+	return fmt.Sprintf("track count is too high (%d > %d)", e.Count, maxTracks)
+}
+
+// IOError is a failure to open, read or write a file
+type IOError struct {
+	Op   string // e.g. "open", "write"
+	Path string
+	Err  error
+}
+
+func (e *IOError) Error() string {
+	return fmt.Sprintf("could not %v %v: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+// ioError wraps err in an IOError, nil stays nil
+func ioError(op string, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &IOError{Op: op, Path: path, Err: err}
+}
+
+// cli exit codes, 1 is any other error and 2 is a usage error
+const (
+	exitInvalidFile = 3 // HeaderError or FormatError
+	exitTrackLimit  = 4
+	exitIO          = 5
+)
+
+// exitCode picks the cli exit code for an error
+func exitCode(err error) int {
+	var headerErr *HeaderError
+	var formatErr *FormatError
+	var limitErr *TrackLimitError
+	var ioErr *IOError
+
+	switch {
+	case errors.As(err, &headerErr), errors.As(err, &formatErr):
+		return exitInvalidFile
+	case errors.As(err, &limitErr):
+		return exitTrackLimit
+	case errors.As(err, &ioErr):
+		return exitIO
+	default:
+		return 1
+	}
+}
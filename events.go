@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// midiEvent is a single event of a track
+type midiEvent struct {
+	delta  uint32
+	status byte   // 0x80-0xef for channel events, 0xf0/0xf7 for sysex, 0xff for meta
+	meta   byte   // meta type, only set when status is 0xff
+	data   []byte // data bytes of channel events, payload of meta and sysex events
+}
+
+func (e midiEvent) isChannelEvent() bool {
+	return e.status >= 0x80 && e.status < 0xf0
+}
+
+// channel returns the channel (1-16) of a channel event, or 0 for any other event
+func (e midiEvent) channel() int {
+	if !e.isChannelEvent() {
+		return 0
+	}
+
+	return int(e.status&0x0f) + 1
+}
+
+func (e midiEvent) isNoteOn() bool {
+	return e.status&0xf0 == 0x90 && len(e.data) == 2 && e.data[1] > 0
+}
+
+// a note on with velocity 0 counts as a note off
+func (e midiEvent) isNoteOff() bool {
+	return e.status&0xf0 == 0x80 || (e.status&0xf0 == 0x90 && len(e.data) == 2 && e.data[1] == 0)
+}
+
+func (e midiEvent) isEndOfTrack() bool {
+	return e.status == 0xff && e.meta == 0x2f
+}
+
+// number of data bytes that follow a channel status byte
+func channelDataLength(status byte) int {
+	switch status & 0xf0 {
+	case 0xc0, 0xd0:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func readVLQ(r io.ByteReader) (uint32, error) {
+	var value uint32
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		value = value<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+
+	return 0, errors.New("variable length quantity is longer than 4 bytes")
+}
+
+// eventReader reads the events of a track one by one, keeping track of running status
+// the data of an event is only valid until the next call to next
+type eventReader struct {
+	r       io.ByteReader
+	running byte
+	buf     []byte
+}
+
+func newEventReader(r io.ByteReader) *eventReader {
+	return &eventReader{r: r, buf: make([]byte, 0, 256)}
+}
+
+// next returns the next event, or io.EOF when there are no more events
+func (er *eventReader) next() (midiEvent, error) {
+	var ev midiEvent
+
+	delta, err := readVLQ(er.r)
+	if err != nil {
+		return ev, err // io.EOF here means a clean end of track data
+	}
+	ev.delta = delta
+
+	status, err := er.r.ReadByte()
+	if err != nil {
+		return ev, unexpectedEOF(err)
+	}
+
+	switch {
+	case status == 0xff:
+		ev.status = status
+		ev.meta, err = er.r.ReadByte()
+		if err != nil {
+			return ev, unexpectedEOF(err)
+		}
+		ev.data, err = er.readPayload()
+		if err != nil {
+			return ev, err
+		}
+	case status == 0xf0 || status == 0xf7:
+		// sysex cancels running status
+		er.running = 0
+		ev.status = status
+		ev.data, err = er.readPayload()
+		if err != nil {
+			return ev, err
+		}
+	case status >= 0x80:
+		if status > 0xf0 {
+			return ev, fmt.Errorf("unexpected system message 0x%x in track", status)
+		}
+		er.running = status
+		ev.status = status
+		ev.data, err = er.readData(channelDataLength(status))
+		if err != nil {
+			return ev, err
+		}
+	default:
+		// running status, the byte we read is the first data byte
+		if er.running == 0 {
+			return ev, errors.New("data byte without a status byte (running status not set)")
+		}
+		ev.status = er.running
+		n := channelDataLength(er.running)
+		er.buf = append(er.buf[:0], status)
+		for i := 1; i < n; i++ {
+			b, err := er.r.ReadByte()
+			if err != nil {
+				return ev, unexpectedEOF(err)
+			}
+			er.buf = append(er.buf, b)
+		}
+		ev.data = er.buf
+	}
+
+	// a status byte where a data byte should be means the track is broken,
+	// writing it back would change how the following events are read
+	if ev.isChannelEvent() {
+		for _, b := range ev.data {
+			if b&0x80 != 0 {
+				return ev, fmt.Errorf("data byte 0x%x of a channel event has the high bit set", b)
+			}
+		}
+	}
+
+	return ev, nil
+}
+
+func (er *eventReader) readPayload() ([]byte, error) {
+	length, err := readVLQ(er.r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return er.readData(int(length))
+}
+
+func (er *eventReader) readData(n int) ([]byte, error) {
+	er.buf = er.buf[:0]
+	for i := 0; i < n; i++ {
+		b, err := er.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		er.buf = append(er.buf, b)
+	}
+
+	return er.buf, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ExistingFile describes a file that new tracks are added to
+type ExistingFile struct {
+	Format        int
+	PPQ           int
+	TrackCount    int     // from the header
+	BPM           float64 // first tempo of the conductor track, 120 if it has none
+	TempoChanges  int     // tempo events in the conductor track
+	TimeSignature string  // first time signature of the conductor track, 4/4 if it has none
+}
+
+// ReadExistingFile reads the header and the conductor track of a file, the other tracks are not read
+func ReadExistingFile(path string) (*ExistingFile, error) {
+	info := &ExistingFile{BPM: 120, TimeSignature: "4/4"}
+	sigFound := false
+
+	err := streamTracks(path, func(header midiHeader, index int, track io.ByteReader) error {
+		info.Format = header.format
+		info.PPQ = header.division
+		info.TrackCount = header.trackCount
+
+		er := newEventReader(track)
+		for {
+			ev, err := er.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			if us, ok := tempoFromEvent(ev); ok {
+				if info.TempoChanges == 0 {
+					info.BPM = 60_000_000 / float64(us)
+				}
+				info.TempoChanges++
+			}
+			if num, den, ok := timeSignatureFromEvent(ev); ok && !sigFound {
+				info.TimeSignature = fmt.Sprintf("%v/%v", num, den)
+				sigFound = true
+			}
+		}
+
+		return errStopStreaming
+	})
+	if err != nil {
+		return nil, err
+	}
+	if info.PPQ == 0 {
+		return nil, errors.New("file has no tracks")
+	}
+
+	return info, nil
+}
+
+func (e *ExistingFile) String() string {
+	ppq := fmt.Sprintf("%v ppq", e.PPQ)
+	if e.PPQ&0x8000 != 0 {
+		ppq = "SMPTE timing"
+	}
+
+	tempo := fmt.Sprintf("%.2f bpm", e.BPM)
+	if e.TempoChanges > 1 {
+		tempo += fmt.Sprintf(" (%v tempo changes)", e.TempoChanges)
+	}
+
+	return fmt.Sprintf("format %v, %v, %v tracks, %v, %v", e.Format, ppq, e.TrackCount, tempo, e.TimeSignature)
+}
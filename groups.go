@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a track group is a set of tracks that share the same channels,
+// program and naming. melody and art used to be hard coded,
+// now they are just the two default groups
+type TrackGroup struct {
+	Name       string `json:"name"`
+	Count      int    `json:"count"`
+	Channels   string `json:"channels"`       // e.g. "1-15" or "1,3,5-8", or auto (see autoChannels.go)
+	Port       int    `json:"port,omitempty"` // midi port, set when auto-port moves the group to another port
+	Program    int    `json:"program"`
+	NameFormat string `json:"nameFormat"` // see formatTrackName
+	AllowDrums bool   `json:"allowDrums"`
+
+	// drum groups always land on a drum part, see drums.go
+	Drums     bool   `json:"drums"`
+	DrumMode  string `json:"drumMode"`  // gm (channel 10 only), gs or xg
+	DrumNames bool   `json:"drumNames"` // name tracks after GM percussion parts
+}
+
+func defaultDrumGroup() TrackGroup {
+	return TrackGroup{Name: "Drums", Count: 1, Channels: "10", Drums: true, DrumMode: "gm", DrumNames: true}
+}
+
+func defaultTrackGroups() []TrackGroup {
+	return []TrackGroup{
+		{Name: "Melody", Count: 8, Channels: "1-15"},
+		{Name: "Art", Count: 8, Channels: "16-16"},
+	}
+}
+
+// parseChannelSet turns a string like "1-4,7,9-10" into a sorted
+// list of unique channels (1-16)
+func parseChannelSet(s string) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("channels cannot be empty")
+	}
+
+	seen := map[int]bool{}
+	var channels []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, errors.New("channels must be in the format of <min>-<max> or <channel>, separated by commas")
+		}
+
+		min, max := part, part
+		if strings.Contains(part, "-") {
+			split := strings.Split(part, "-")
+			if len(split) != 2 {
+				return nil, errors.New("range must be in the format of <min>-<max>")
+			}
+			min, max = split[0], split[1]
+		}
+
+		minInt, err := strconv.Atoi(strings.TrimSpace(min))
+		if err != nil {
+			return nil, errors.New("min is not a number")
+		}
+		maxInt, err := strconv.Atoi(strings.TrimSpace(max))
+		if err != nil {
+			return nil, errors.New("max is not a number")
+		}
+
+		if maxInt > 16 {
+			return nil, errors.New("max cannot be greater than 16")
+		}
+		if minInt < 1 {
+			return nil, errors.New("min cannot be less than 1")
+		}
+		if minInt > maxInt {
+			return nil, errors.New("min cannot be greater than max")
+		}
+
+		for ch := minInt; ch <= maxInt; ch++ {
+			if !seen[ch] {
+				seen[ch] = true
+				channels = append(channels, ch)
+			}
+		}
+	}
+
+	sort.Ints(channels)
+	return channels, nil
+}
+
+// validateChannels checks the channels field of a group, a channel set or one of the auto modes
+func validateChannels(s string) error {
+	if isAutoChannels(s) {
+		return nil
+	}
+	_, err := parseChannelSet(s)
+	return err
+}
+
+// channelSet returns the channels of the group
+// gm drum groups are always on channel 10
+func (g TrackGroup) channelSet() ([]int, error) {
+	if g.Drums && gmDrumMode(g.DrumMode) {
+		return []int{10}, nil
+	}
+	// auto channels are resolved before creating, until then any channel can be picked
+	if isAutoChannels(g.Channels) {
+		return parseChannelSet("1-16")
+	}
+
+	return parseChannelSet(g.Channels)
+}
+
+func (g TrackGroup) allowsDrumChannel() bool {
+	return g.AllowDrums || g.Drums
+}
+
+// usableChannels returns the channels the group can create tracks on,
+// leaving out channel 10 if drums are not allowed
+func (g TrackGroup) usableChannels() ([]int, error) {
+	channels, err := g.channelSet()
+	if err != nil {
+		return nil, err
+	}
+
+	if g.allowsDrumChannel() {
+		return channels, nil
+	}
+
+	var usable []int
+	for _, ch := range channels {
+		if ch != 10 {
+			usable = append(usable, ch)
+		}
+	}
+	if len(usable) == 0 {
+		return nil, errors.New("only channel 10 is selected but drums are not allowed")
+	}
+
+	return usable, nil
+}
+
+func (g TrackGroup) Validate() error {
+	if strings.TrimSpace(g.Name) == "" {
+		return errors.New("name cannot be empty")
+	}
+	if g.Count < 0 || g.Count > 65535 {
+		return errors.New("count out of range")
+	}
+	if g.Program < 0 || g.Program > 127 {
+		return errors.New("program must be between 0 and 127")
+	}
+	if !validDrumMode(g.DrumMode) {
+		return errors.New("drum mode must be gm, gs or xg")
+	}
+	if _, err := g.usableChannels(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateTrackGroups(groups []TrackGroup) error {
+	for i, g := range groups {
+		if err := g.Validate(); err != nil {
+			return fmt.Errorf("group %v (%v): %w", i+1, g.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func totalTrackCount(groups []TrackGroup) int {
+	total := 0
+	for _, g := range groups {
+		total += g.Count
+	}
+
+	return total
+}
+
+// formatTrackName fills in the group's name format
+// {group} is the group name, {n} is the track number within the group
+// {ch} is the channel of the track and {drum} is the GM percussion part
+func formatTrackName(format string, group string, n int, channel int) string {
+	return strings.NewReplacer(
+		"{group}", group,
+		"{n}", strconv.Itoa(n),
+		"{ch}", strconv.Itoa(channel),
+		"{drum}", percussionName(n),
+	).Replace(format)
+}
+
+// trackName returns the name of the nth track (starting at 1) of the group
+func (g TrackGroup) trackName(n int, channel int) string {
+	format := g.NameFormat
+	if g.Drums && g.DrumNames && format == "" {
+		format = "{drum}"
+	}
+
+	return formatTrackName(format, g.Name, n, channel)
+}
+
+func encodeTrackGroups(groups []TrackGroup) (string, error) {
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func decodeTrackGroups(s string) ([]TrackGroup, error) {
+	var groups []TrackGroup
+	if err := json.Unmarshal([]byte(s), &groups); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
@@ -1,14 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"image/color"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -24,7 +25,12 @@ import (
 )
 
 func createGUI() {
-	logf("Opening GUI")
+	// debug lines go to stderr like they always have, the output box shows what the settings ask for
+	appLog.AddSink(LevelDebug, newStderrSink())
+	var setOutputLogLevel func(Level)
+	var refreshPreview func() // set once every field exists
+
+	appLog.Debugf("Opening GUI")
 
 	a := app.NewWithID("xyz.6gh.emptytrackcreator")
 	window := a.NewWindow("Empty Track Creator")
@@ -38,7 +44,7 @@ func createGUI() {
 
 	helpBar := widget.NewToolbar(
 		widget.NewToolbarAction(theme.HelpIcon(), func() {
-			logf("Opening help dialog")
+			appLog.Debugf("Opening help dialog")
 
 			icon := canvas.NewImageFromResource(window.Icon())
 			icon.SetMinSize(fyne.NewSize(128, 128))
@@ -58,13 +64,11 @@ func createGUI() {
 			creator := canvas.NewText("Created by 6gh", color.White)
 			creator.Alignment = fyne.TextAlignCenter
 
-			fyneUrl, err := url.Parse("https://fyne.io/")
-			handleErr(err)
+			fyneUrl, _ := url.Parse("https://fyne.io/")
 			fyneLbl := widget.NewHyperlink("Made with Fyne", fyneUrl)
 			fyneLbl.Alignment = fyne.TextAlignCenter
 
-			repoUrl, err := url.Parse("https://github.com/6gh/Empty-Track-Creator")
-			handleErr(err)
+			repoUrl, _ := url.Parse("https://github.com/6gh/Empty-Track-Creator")
 			repoLbl := widget.NewHyperlink("Check on GitHub", repoUrl)
 			repoLbl.Alignment = fyne.TextAlignCenter
 
@@ -74,128 +78,61 @@ func createGUI() {
 			dialog.ShowCustom("About", "Close", vBox, window)
 		}),
 		widget.NewToolbarAction(theme.SettingsIcon(), func() {
-			logf("Opening settings dialog")
-
-			title := canvas.NewText("Additional Settings", color.White)
-			title.TextStyle = fyne.TextStyle{
-				Bold: true,
-			}
-			title.Alignment = fyne.TextAlignCenter
-			title.TextSize = 24
+			appLog.Debugf("Opening settings dialog")
 
-			drumsChk := widget.NewCheck("Allow Drums channel?", func(bool) {})
+			orderSel := widget.NewSelect(trackOrders, func(string) {})
+			orderSel.SetSelected(a.Preferences().StringWithFallback("trackOrder", "grouped"))
 
-			melodyTracksRange := widget.NewEntry()
-			melodyTracksRange.Validator = func(s string) error {
-				if s == "" {
-					return errors.New("range cannot be empty")
-				}
-				if !strings.Contains(s, "-") {
-					return errors.New("range must be in the format of <min>-<max>")
-				}
+			orderPatternTXT := widget.NewEntry()
+			orderPatternTXT.SetPlaceHolder("e.g. Melody,Melody,Art")
+			orderPatternTXT.SetText(a.Preferences().String("trackOrderPattern"))
 
-				split := strings.Split(s, "-")
-				if len(split) != 2 {
-					return errors.New("range must be in the format of <min>-<max>")
-				}
+			runningStatusChk := widget.NewCheck("Use running status", func(bool) {})
+			runningStatusChk.SetChecked(a.Preferences().Bool("runningStatus"))
 
-				min, err := strconv.Atoi(split[0])
-				if err != nil {
-					return errors.New("min is not a number")
-				}
-
-				max, err := strconv.Atoi(split[1])
-				if err != nil {
-					return errors.New("max is not a number")
-				}
-
-				if max > 16 {
-					return errors.New("max cannot be greater than 16")
-				}
-				if min < 1 {
-					return errors.New("min cannot be less than 1")
-				}
-
-				if min > max {
-					return errors.New("min cannot be greater than max")
-				}
-
-				return nil
-			}
-			artTrackRange := widget.NewEntry()
-			artTrackRange.Validator = func(s string) error {
-				if s == "" {
-					return errors.New("range cannot be empty")
-				}
-				if !strings.Contains(s, "-") {
-					return errors.New("range must be in the format of <min>-<max>")
-				}
-
-				split := strings.Split(s, "-")
-				if len(split) != 2 {
-					return errors.New("range must be in the format of <min>-<max>")
-				}
-
-				min, err := strconv.Atoi(split[0])
-				if err != nil {
-					return errors.New("min is not a number")
-				}
-
-				max, err := strconv.Atoi(split[1])
-				if err != nil {
-					return errors.New("max is not a number")
-				}
-
-				if max > 16 {
-					return errors.New("max cannot be greater than 16")
-				}
-				if min < 1 {
-					return errors.New("min cannot be less than 1")
-				}
-
-				if min > max {
-					return errors.New("min cannot be greater than max")
-				}
-
-				return nil
-			}
-
-			melodyTracksRange.SetText(a.Preferences().StringWithFallback("melodyTracksRange", "1-15"))
-			artTrackRange.SetText(a.Preferences().StringWithFallback("artTracksRange", "16-16"))
-			drumsChk.Checked = a.Preferences().BoolWithFallback("allowDrums", false)
+			logLevelSel := widget.NewSelect(logLevels, func(string) {})
+			logLevelSel.SetSelected(a.Preferences().StringWithFallback("logLevel", "info"))
 
 			dialog.ShowForm("Settings", "Save", "Cancel", []*widget.FormItem{
 				{
-					Text:     "Melody Tracks Range",
-					Widget:   melodyTracksRange,
-					HintText: "The range of channels to create melody tracks on",
+					Text:     "Track Order",
+					Widget:   orderSel,
+					HintText: "grouped, interleaved (one of each group in turn), by channel, or custom",
+				},
+				{
+					Text:     "Custom Order",
+					Widget:   orderPatternTXT,
+					HintText: "Group names, repeated until every track is placed",
 				},
 				{
-					Text:     "Art Tracks Range",
-					Widget:   artTrackRange,
-					HintText: "The range of channels to create art tracks on",
+					Text:     "Running Status",
+					Widget:   runningStatusChk,
+					HintText: "Leave out repeated status bytes in written tracks to make files smaller",
 				},
 				{
-					Text:     "CH-10",
-					Widget:   drumsChk,
-					HintText: "If unchecked, channel 10 will be skipped",
+					Text:     "Log Level",
+					Widget:   logLevelSel,
+					HintText: "The lowest level kept in the output, debug keeps everything",
 				},
 			}, func(b bool) {
 				if b {
-					a.Preferences().SetString("melodyTracksRange", melodyTracksRange.Text)
-					a.Preferences().SetString("artTracksRange", artTrackRange.Text)
-					a.Preferences().SetBool("allowDrums", drumsChk.Checked)
-					logf("Settings closed and saved")
+					a.Preferences().SetString("trackOrder", orderSel.Selected)
+					a.Preferences().SetString("trackOrderPattern", orderPatternTXT.Text)
+					a.Preferences().SetBool("runningStatus", runningStatusChk.Checked)
+					a.Preferences().SetString("logLevel", logLevelSel.Selected)
+					level, _ := parseLevel(logLevelSel.Selected)
+					setOutputLogLevel(level)
+					refreshPreview()
+					appLog.Debugf("Settings closed and saved")
 				}
 			}, window)
 		}),
 	)
 
 	// create all labels first
-	MelodyTrackLbl := createTxt("Melody Tracks:")
-	ArtTrackLbl := createTxt("Art Tracks:")
 	PPQLbl := createTxt("PPQ:")
 	BPMLbl := createTxt("BPM:")
+	InsertLbl := createTxt("Insert:")
 
 	OutputTXT := widget.NewEntry()
 	OutputTXT.Validator = func(s string) error {
@@ -207,23 +144,76 @@ func createGUI() {
 		}
 		return nil
 	}
-	MelodyTrackTXT := createNumberInput(0, 65535)
-	ArtTrackTXT := createNumberInput(0, 65535)
+	groups := newGroupList(a.Preferences(), window)
 	PPQTXT := widget.NewSelect([]string{"96", "192", "240", "480", "960", "1920", "3840", "8192"}, func(string) {})
-	BPMTXT := createNumberInput(0, 65535)
+	BPMTXT := createNumberInput(4, 65535)
+	InsertSel := widget.NewSelect(insertModes, func(string) {})
+	InsertTXT := createNumberInput(0, 65535)
+	InsertTXT.SetPlaceHolder("track index or channel")
+	conductor := ConductorOptions{Mode: "keep"}
+	existingLbl := widget.NewLabel("")
+	existingLbl.Wrapping = fyne.TextWrapWord
+
+	// the ppq and bpm only apply to new files, for an existing file they are locked
+	// and what the file uses is shown instead
+	refreshExisting := func() {
+		if _, err := os.Stat(OutputTXT.Text); err != nil {
+			existingLbl.SetText("New file")
+			PPQTXT.Enable()
+			BPMTXT.Enable()
+			return
+		}
+
+		info, err := ReadExistingFile(OutputTXT.Text)
+		if err != nil {
+			existingLbl.SetText("Existing file, could not be read: " + err.Error())
+		} else {
+			existingLbl.SetText("Existing file: " + info.String() + ". PPQ and BPM are not used when adding tracks")
+			if info.Format != 1 {
+				existingLbl.SetText(existingLbl.Text + ". Only format 1 files can have tracks added")
+			}
+		}
+
+		PPQTXT.Disable()
+		if conductor.Mode == "set-tempo" {
+			BPMTXT.Enable()
+		} else {
+			BPMTXT.Disable()
+		}
+	}
+	OutputTXT.OnChanged = func(string) {
+		refreshExisting()
+		if refreshPreview != nil {
+			refreshPreview()
+		}
+	}
+
+	var conductorButton *widget.Button
+	conductorButton = widget.NewButton(conductorSummary(conductor), func() {
+		showConductorDialog(window, OutputTXT.Text, conductor, func(opts ConductorOptions) {
+			conductor = opts
+			conductorButton.SetText(conductorSummary(conductor))
+			refreshPreview()
+			appLog.Debugf("conductor options changed: %+v", conductor)
+			refreshExisting()
+		})
+	})
 
-	OutputBox := widget.NewMultiLineEntry()
-	OutputBox.SetText("Output will go here...")
+	output := newOutputView(a.Preferences(), window)
+	outputLevel, _ := parseLevel(a.Preferences().StringWithFallback("logLevel", "info"))
+	setOutputLogLevel = appLog.AddSink(outputLevel, output.history)
 
 	outputButton := widget.NewButtonWithIcon("Output Path", theme.FileIcon(), func() {
-		logf("Opening output path dialog")
+		appLog.Debugf("Opening output path dialog")
 
 		filePath, err := sqdialog.File().Filter("MIDI Files (.mid)", "mid").Title("Select Output Path").Save()
 		if errors.Is(err, sqdialog.ErrCancelled) {
-			logf("User cancelled output path dialog")
+			appLog.Debugf("User cancelled output path dialog")
 			return // user cancelled
-		} else {
-			handleErr(err)
+		} else if err != nil {
+			appLog.Debugf("could not open output path dialog: %v", err)
+			dialog.ShowError(err, window)
+			return
 		}
 
 		// append .mid if not present
@@ -231,20 +221,30 @@ func createGUI() {
 			filePath += ".mid"
 		}
 
-		logf("Output path selected: %s", filePath)
+		appLog.Debugf("Output path selected: %s", filePath)
 		OutputTXT.SetText(filePath)
 	})
 
-	createButton := widget.NewButton("Create", func() {
+	// the state of a running creation, set by the create button
+	var (
+		progressBar  *widget.ProgressBar
+		cancelButton *widget.Button
+		cancelRun    context.CancelFunc
+		runDone      chan struct{}
+		setRunning   func(running bool)
+	)
+
+	// createOptions reads the fields into the options Create uses,
+	// or lists the fields that are not valid
+	createOptions := func() (CreateOptions, []string) {
 		var errs []string
 		if err := OutputTXT.Validate(); err != nil {
 			errs = append(errs, "output: "+err.Error())
 		}
-		if err := MelodyTrackTXT.Validate(); err != nil {
-			errs = append(errs, "melody tracks: "+err.Error())
-		}
-		if err := ArtTrackTXT.Validate(); err != nil {
-			errs = append(errs, "art tracks: "+err.Error())
+		if err := validateTrackGroups(groups.groups); err != nil {
+			errs = append(errs, "track groups: "+err.Error())
+		} else if totalTrackCount(groups.groups) == 0 {
+			errs = append(errs, "track groups: no tracks to create")
 		}
 		if PPQTXT.Selected == "" {
 			errs = append(errs, "ppq: cannot be empty")
@@ -252,144 +252,179 @@ func createGUI() {
 		if err := BPMTXT.Validate(); err != nil {
 			errs = append(errs, "bpm: "+err.Error())
 		}
-
+		if InsertSel.Selected != "end" {
+			if err := InsertTXT.Validate(); err != nil {
+				errs = append(errs, "insert: "+err.Error())
+			}
+		}
 		if len(errs) > 0 {
-			dialog.ShowInformation("Invalid Options", strings.Join(errs, "\n"), window)
-		} else {
-			logf("starting creation | blocked ui")
-			var startTime time.Time
-
-			logf("timer enabled, starting timer now")
-			startTime = time.Now()
-
-			OutputBox.SetText("")
-
-			melody, err := strconv.Atoi(MelodyTrackTXT.Text)
-			handleErr(err)
-			art, err := strconv.Atoi(ArtTrackTXT.Text)
-			handleErr(err)
-			pqq, err := strconv.Atoi(PPQTXT.Selected)
-			handleErr(err)
-			bpm, err := strconv.Atoi(BPMTXT.Text)
-			handleErr(err)
-
-			melodyTrackRangeSTR := a.Preferences().StringWithFallback("melodyTracksRange", "1-15")
-			split := strings.Split(melodyTrackRangeSTR, "-")
-			min, err := strconv.Atoi(split[0])
-			handleErr(err)
-			max, err := strconv.Atoi(split[1])
-			handleErr(err)
-			melodyTrackRange := []int{min, max}
-
-			artTrackRangeSTR := a.Preferences().StringWithFallback("artTracksRange", "16-16")
-			split = strings.Split(artTrackRangeSTR, "-")
-			min, err = strconv.Atoi(split[0])
-			handleErr(err)
-			max, err = strconv.Atoi(split[1])
-			handleErr(err)
-			artTrackRange := []int{min, max}
-
-			drumsEnabled := a.Preferences().BoolWithFallback("allowDrums", false)
-
-			MelodyTrackTXT.Disable()
-			ArtTrackTXT.Disable()
-			OutputTXT.Disable()
-			PPQTXT.Disable()
-			BPMTXT.Disable()
-			outputButton.Disable()
+			return CreateOptions{}, errs
+		}
 
-			window.SetTitle("Empty Track Creator (Running...)")
+		// the fields were validated above, so these can't fail
+		ppq, _ := strconv.Atoi(PPQTXT.Selected)
+		bpm, _ := strconv.Atoi(BPMTXT.Text)
+		insert := InsertPosition{Mode: InsertSel.Selected}
+		if insert.Mode != "end" {
+			insert.Value, _ = strconv.Atoi(InsertTXT.Text)
+		}
 
-			var trackCount int
-			filePath := OutputTXT.Text
+		return CreateOptions{
+			Path:   OutputTXT.Text,
+			Groups: append([]TrackGroup{}, groups.groups...),
+			Order: TrackOrder{
+				Mode:    a.Preferences().StringWithFallback("trackOrder", "grouped"),
+				Pattern: a.Preferences().String("trackOrderPattern"),
+			},
+			PPQ:           ppq,
+			BPM:           bpm,
+			Insert:        insert,
+			Conductor:     conductor,
+			RunningStatus: a.Preferences().Bool("runningStatus"),
+		}, nil
+	}
 
-			// if the user chooses a .mid file, we read the track count from that
+	// the preview plans again whenever a field changes
+	preview := newPreviewPanel()
+	refreshPreview = func() {
+		opts, errs := createOptions()
+		if len(errs) > 0 {
+			preview.schedule(opts, errors.New(strings.Join(errs, ", ")))
+			return
+		}
+		preview.schedule(opts, nil)
+	}
+	groups.onChanged = refreshPreview
+	PPQTXT.OnChanged = func(string) { refreshPreview() }
+	BPMTXT.OnChanged = func(string) { refreshPreview() }
+	InsertSel.OnChanged = func(string) { refreshPreview() }
+	InsertTXT.OnChanged = func(string) { refreshPreview() }
 
-			// check if file exists
-			if _, err := os.Stat(filePath); os.IsNotExist(err) {
-				logf("File input does not exist, continuing with new file")
+	var bottomTabs *container.AppTabs
 
-				trackCount = melody + art
-			} else {
-				logf("File input exists, reading track count from file")
-
-				miditrackcount, err := ReadMIDITracks(filePath, func(format string, a ...any) {
-					OutputBox.SetText(OutputBox.Text + fmt.Sprintf(format, a...) + "\n")
-				})
-				if err != nil {
-					logf("Error reading track count from file: %s | unblocking ui", err.Error())
-
-					dialog.ShowError(err, window)
-
-					MelodyTrackTXT.Enable()
-					ArtTrackTXT.Enable()
-					OutputTXT.Enable()
-					PPQTXT.Enable()
-					BPMTXT.Enable()
-					outputButton.Enable()
-					window.SetTitle("Empty Track Creator")
+	var createButton *widget.Button
+	createButton = widget.NewButton("Create", func() {
+		opts, errs := createOptions()
+		if len(errs) > 0 {
+			dialog.ShowInformation("Invalid Options", strings.Join(errs, "\n"), window)
+			return
+		}
+
+		bottomTabs.SelectIndex(0) // show the output
+		appLog.Debugf("starting creation | blocked ui")
+		startTime := time.Now()
+		output.Clear()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelRun = cancel
+		runDone = make(chan struct{})
+		setRunning(true)
+
+		// the bar is updated on a timer, a call per track would redraw it thousands of times
+		var progressMu sync.Mutex
+		var progress CreateProgress
+		opts.Progress = func(p CreateProgress) {
+			progressMu.Lock()
+			progress = p
+			progressMu.Unlock()
+		}
+		progressBar.TextFormatter = func() string {
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			return progress.String()
+		}
+
+		// tracks edited in the preview are written as they are, otherwise they are planned from the fields
+		plan := preview.editedPlan()
+		result := make(chan error, 1)
+		go func() {
+			if plan != nil {
+				appLog.Infof("writing the %v tracks edited in the preview", len(plan.Tracks))
+				result <- WritePlan(ctx, plan, opts, appLog)
+				return
+			}
+			result <- CreateMIDI(ctx, opts, appLog)
+		}()
+
+		go func() {
+			ticker := time.NewTicker(outputRefreshInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					progressMu.Lock()
+					fraction := progress.Fraction()
+					progressMu.Unlock()
+					progressBar.SetValue(fraction)
+				case err := <-result:
+					cancel()
+					setRunning(false)
+					close(runDone)
+
+					switch {
+					case errors.Is(err, context.Canceled):
+						appLog.Warnf("cancelled after %v, %v was not changed", time.Since(startTime), opts.Path)
+					case err != nil:
+						appLog.Errorf("could not create tracks: %v", err)
+						dialog.ShowError(err, window)
+					default:
+						appLog.Debugf("wrote to %v | unblocking ui", opts.Path)
+						appLog.Infof("took %v", time.Since(startTime))
+						// the file has changed, so the planned tracks (and any edits) are done with
+						preview.Reset()
+					}
 					return
-				} else {
-					trackCount = miditrackcount + melody + art
 				}
 			}
+		}()
+	})
 
-			if trackCount > 65535 {
-				logf("Track count would be too high (%d > 65535) | unblocking ui", trackCount)
-
-				dialog.ShowError(fmt.Errorf("track count is too high (%d > 65535)", trackCount), window)
-
-				MelodyTrackTXT.Enable()
-				ArtTrackTXT.Enable()
-				OutputTXT.Enable()
-				PPQTXT.Enable()
-				BPMTXT.Enable()
-				outputButton.Enable()
-				window.SetTitle("Empty Track Creator")
-
-				return
+	progressBar = widget.NewProgressBar()
+	progressBar.Hide()
+	cancelButton = widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), func() {
+		appLog.Infof("cancelling...")
+		cancelRun()
+	})
+	cancelButton.Hide()
+
+	// setRunning locks every input while tracks are created and puts them back after
+	setRunning = func(running bool) {
+		inputs := []interface {
+			Enable()
+			Disable()
+		}{groups, preview, OutputTXT, PPQTXT, BPMTXT, InsertSel, InsertTXT, conductorButton, outputButton, createButton}
+
+		for _, input := range inputs {
+			if running {
+				input.Disable()
 			} else {
-				logf("creating %v melody + %v art = %v total tracks", melody, art, melody+art)
-				tracks := createTracks(melody, art, drumsEnabled, melodyTrackRange, artTrackRange, func(format string, a ...any) {
-					OutputBox.SetText(OutputBox.Text + fmt.Sprintf(format, a...) + "\n")
-				})
-				logf("created tracks")
-
-				logf("writing to %v", filePath)
-				WriteMIDI(MIDIInfo{
-					tracks:     tracks,
-					trackCount: trackCount,
-					midiPath:   filePath,
-					ppq:        pqq,
-					bpm:        bpm,
-					allowDrums: drumsEnabled,
-					logger: func(format string, a ...any) {
-						OutputBox.SetText(OutputBox.Text + fmt.Sprintf(format, a...) + "\n")
-					},
-					callback: func() {
-						MelodyTrackTXT.Enable()
-						ArtTrackTXT.Enable()
-						OutputTXT.Enable()
-						PPQTXT.Enable()
-						BPMTXT.Enable()
-						outputButton.Enable()
-						window.SetTitle("Empty Track Creator")
-					},
-				})
-				logf("wrote to %v | unblocking ui", filePath)
-
-				logf("timer enabled, stopping timer now | took %v", time.Since(startTime))
-				OutputBox.SetText(OutputBox.Text + fmt.Sprintf("took %v", time.Since(startTime)) + "\n")
+				input.Enable()
 			}
 		}
-	})
+
+		if running {
+			progressBar.SetValue(0)
+			progressBar.Show()
+			cancelButton.Show()
+			window.SetTitle("Empty Track Creator (Running...)")
+			return
+		}
+
+		progressBar.Hide()
+		cancelButton.Hide()
+		refreshExisting()
+		window.SetTitle("Empty Track Creator")
+	}
 
 	// set default values
 	OutputTXT.SetText(a.Preferences().StringWithFallback("outputPath", "output.mid"))
-	MelodyTrackTXT.SetText(a.Preferences().StringWithFallback("melodyTracks", "8"))
-	ArtTrackTXT.SetText(a.Preferences().StringWithFallback("artTracks", "8"))
 	PPQTXT.SetSelected(a.Preferences().StringWithFallback("ppq", "960"))
 	BPMTXT.SetText(a.Preferences().StringWithFallback("bpm", "138"))
+	refreshExisting()
+	InsertSel.SetSelected(a.Preferences().StringWithFallback("insertMode", "end"))
+	InsertTXT.SetText(a.Preferences().String("insertValue"))
+	refreshPreview()
 
 	// make rows
 	outputRow := container.New(
@@ -399,17 +434,17 @@ func createGUI() {
 			outputButton,
 		), OutputTXT,
 	)
-	tracksRow := container.New(layout.NewGridLayout(2),
-		container.New(layout.NewFormLayout(), MelodyTrackLbl, MelodyTrackTXT),
-		container.New(layout.NewFormLayout(), ArtTrackLbl, ArtTrackTXT),
-	)
 	midiRow := container.New(layout.NewGridLayout(2),
 		container.New(layout.NewFormLayout(), PPQLbl, PPQTXT),
-		container.New(layout.NewFormLayout(), BPMLbl, BPMTXT),
+		container.New(layout.NewFormLayout(), BPMLbl, container.NewBorder(nil, nil, nil, conductorButton, BPMTXT)),
 	)
-	bottomRow := container.New(
-		layout.NewMaxLayout(),
-		OutputBox,
+	insertRow := container.New(layout.NewGridLayout(2),
+		container.New(layout.NewFormLayout(), InsertLbl, InsertSel),
+		InsertTXT,
+	)
+	bottomTabs = container.NewAppTabs(
+		container.NewTabItem("Output", output.content()),
+		container.NewTabItem("Preview", preview.content()),
 	)
 
 	// put into a column
@@ -417,30 +452,30 @@ func createGUI() {
 		container.New(
 			layout.NewVBoxLayout(),
 			outputRow,
-			tracksRow,
+			existingLbl,
 			midiRow,
+			insertRow,
 			createButton,
+			container.NewBorder(nil, nil, nil, cancelButton, progressBar),
 		),
 		helpBar,
 		nil,
 		nil,
-		container.New(
-			layout.NewMaxLayout(),
-			bottomRow,
+		container.NewVSplit(
+			groups.content(),
+			bottomTabs,
 		),
 	)
 
-	window.SetCloseIntercept(func() {
-		logf("GUI closed, saving settings")
+	window.SetMainMenu(fyne.NewMainMenu(
+		createToolsMenu(window, appLog),
+	))
+
+	closeWindow := func() {
+		appLog.Debugf("GUI closed, saving settings")
 		if OutputTXT.Text == "" {
 			OutputTXT.SetText("output.mid")
 		}
-		if MelodyTrackTXT.Text == "" {
-			MelodyTrackTXT.SetText("output.mid")
-		}
-		if ArtTrackTXT.Text == "" {
-			ArtTrackTXT.SetText("output.mid")
-		}
 		if PPQTXT.Selected == "" {
 			PPQTXT.SetSelected("960")
 		}
@@ -449,12 +484,34 @@ func createGUI() {
 		}
 
 		a.Preferences().SetString("outputPath", OutputTXT.Text)
-		a.Preferences().SetString("melodyTracks", MelodyTrackTXT.Text)
-		a.Preferences().SetString("artTracks", ArtTrackTXT.Text)
+		saveTrackGroups(a.Preferences(), groups.groups)
 		a.Preferences().SetString("ppq", PPQTXT.Selected)
 		a.Preferences().SetString("bpm", BPMTXT.Text)
+		a.Preferences().SetString("insertMode", InsertSel.Selected)
+		a.Preferences().SetString("insertValue", InsertTXT.Text)
 
+		appLog.RemoveSink(output.history)
+		output.Close()
 		window.Close()
+	}
+
+	window.SetCloseIntercept(func() {
+		if runDone != nil {
+			select {
+			case <-runDone:
+			default:
+				// let the run remove its temporary file before closing
+				appLog.Debugf("GUI closed while running, cancelling")
+				cancelRun()
+				go func() {
+					<-runDone
+					closeWindow()
+				}()
+				return
+			}
+		}
+
+		closeWindow()
 	})
 
 	window.SetContent(content)
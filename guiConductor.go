@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// conductorSummary is the text of the button that opens the conductor dialog
+func conductorSummary(opts ConductorOptions) string {
+	text := "Tempo: " + opts.Mode
+	if len(opts.TimeSignatures) > 0 {
+		text += fmt.Sprintf(" +%v sig", len(opts.TimeSignatures))
+	}
+	return text
+}
+
+func formatBarTimeSignatures(sigs []BarTimeSignature) string {
+	var parts []string
+	for _, sig := range sigs {
+		parts = append(parts, fmt.Sprintf("%v:%v/%v", sig.Bar, sig.Numerator, sig.Denominator))
+	}
+	return strings.Join(parts, ",")
+}
+
+// showConductorDialog shows the tempo events of the existing file and lets the user choose
+// what happens to them when tracks are added, onSave is only called with valid options
+func showConductorDialog(window fyne.Window, filePath string, current ConductorOptions, onSave func(ConductorOptions)) {
+	appLog.Debugf("Opening conductor dialog")
+
+	preview := "The file does not exist yet, it is created with the BPM above"
+	if _, err := os.Stat(filePath); err == nil {
+		lines, err := describeTempoEvents(filePath)
+		if err != nil {
+			preview = "could not read the tempo events: " + err.Error()
+		} else {
+			preview = formatTempoEvents(lines)
+		}
+	}
+
+	previewLbl := widget.NewLabel(preview)
+	previewScroll := container.NewScroll(previewLbl)
+	previewScroll.SetMinSize(fyne.NewSize(450, 150))
+
+	modeSel := widget.NewSelect(conductorModes, func(string) {})
+	modeSel.SetSelected(current.Mode)
+	importTXT, importInput := createFileInput("Select Tempo Map File")
+	importTXT.Validator = nil
+	importTXT.SetText(current.ImportPath)
+	sigsTXT := widget.NewEntry()
+	sigsTXT.SetPlaceHolder("e.g. 1:4/4,17:3/4")
+	sigsTXT.SetText(formatBarTimeSignatures(current.TimeSignatures))
+
+	dialog.ShowForm("Existing Tempo", "Save", "Cancel", []*widget.FormItem{
+		{
+			Text:   "Current",
+			Widget: previewScroll,
+		},
+		{
+			Text:     "Mode",
+			Widget:   modeSel,
+			HintText: "keep, set-tempo (one tempo from the BPM field) or import (tempo map of another file)",
+		},
+		{
+			Text:     "Import From",
+			Widget:   importInput,
+			HintText: "The file whose tempo and time signatures are used by import",
+		},
+		{
+			Text:     "Time Signatures",
+			Widget:   sigsTXT,
+			HintText: "bar:numerator/denominator, added after the mode is applied",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		sigs, err := parseTimeSignatures(sigsTXT.Text)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		if modeSel.Selected == "import" && importTXT.Text == "" {
+			dialog.ShowError(errors.New("select a file to import the tempo map from"), window)
+			return
+		}
+
+		onSave(ConductorOptions{
+			Mode:           modeSel.Selected,
+			ImportPath:     importTXT.Text,
+			TimeSignatures: sigs,
+		})
+	}, window)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// groupList is the editable list of track groups on the main window
+// every change is saved to preferences straight away
+type groupList struct {
+	groups   []TrackGroup
+	selected int
+
+	prefs   fyne.Preferences
+	window  fyne.Window
+	list    *widget.List
+	buttons []*widget.Button
+
+	onChanged func() // called after every change, may be nil
+}
+
+func loadTrackGroups(prefs fyne.Preferences) []TrackGroup {
+	if s := prefs.String("trackGroups"); s != "" {
+		groups, err := decodeTrackGroups(s)
+		if err == nil {
+			return groups
+		}
+		appLog.Debugf("could not read track groups from preferences, using defaults: %v", err)
+		return defaultTrackGroups()
+	}
+
+	// migrate the old melody/art preferences into groups
+	appLog.Debugf("no track groups saved, creating them from melody/art preferences")
+	groups := defaultTrackGroups()
+	allowDrums := prefs.BoolWithFallback("allowDrums", false)
+
+	melody, err := strconv.Atoi(prefs.StringWithFallback("melodyTracks", "8"))
+	if err == nil {
+		groups[0].Count = melody
+	}
+	groups[0].Channels = prefs.StringWithFallback("melodyTracksRange", "1-15")
+	groups[0].AllowDrums = allowDrums
+
+	art, err := strconv.Atoi(prefs.StringWithFallback("artTracks", "8"))
+	if err == nil {
+		groups[1].Count = art
+	}
+	groups[1].Channels = prefs.StringWithFallback("artTracksRange", "16-16")
+	groups[1].AllowDrums = allowDrums
+
+	return groups
+}
+
+func saveTrackGroups(prefs fyne.Preferences, groups []TrackGroup) {
+	s, err := encodeTrackGroups(groups)
+	if err != nil {
+		appLog.Debugf("could not save track groups: %v", err)
+		return
+	}
+	prefs.SetString("trackGroups", s)
+}
+
+func newGroupList(prefs fyne.Preferences, window fyne.Window) *groupList {
+	g := &groupList{
+		groups:   loadTrackGroups(prefs),
+		selected: -1,
+		prefs:    prefs,
+		window:   window,
+	}
+
+	g.list = widget.NewList(
+		func() int {
+			return len(g.groups)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(describeGroup(g.groups[id]))
+		},
+	)
+	g.list.OnSelected = func(id widget.ListItemID) {
+		g.selected = id
+	}
+	g.list.OnUnselected = func(id widget.ListItemID) {
+		g.selected = -1
+	}
+
+	return g
+}
+
+func describeGroup(g TrackGroup) string {
+	if g.Drums {
+		mode := strings.ToLower(g.DrumMode)
+		if mode == "" {
+			mode = "gm"
+		}
+		channels := "10"
+		if mode != "gm" {
+			channels = g.Channels
+		}
+		desc := fmt.Sprintf("%v: %v drum tracks on channels %v (%v), %v kit", g.Name, g.Count, channels, strings.ToUpper(mode), drumKitName(g.Program))
+		if g.DrumNames {
+			desc += ", named after percussion parts"
+		}
+		return desc
+	}
+
+	desc := fmt.Sprintf("%v: %v tracks on channels %v, program %v", g.Name, g.Count, g.Channels, g.Program)
+	if g.AllowDrums {
+		desc += ", drums allowed"
+	}
+	if g.NameFormat != "" {
+		desc += fmt.Sprintf(", named \"%v\"", g.NameFormat)
+	}
+
+	return desc
+}
+
+func (g *groupList) save() {
+	saveTrackGroups(g.prefs, g.groups)
+	g.list.Refresh()
+	if g.onChanged != nil {
+		g.onChanged()
+	}
+}
+
+func (g *groupList) content() fyne.CanvasObject {
+	addBtn := widget.NewButtonWithIcon("Add", theme.ContentAddIcon(), func() {
+		appLog.Debugf("Opening add group dialog")
+		g.showEditDialog(TrackGroup{Name: "Group", Count: 1, Channels: "1-15"}, func(group TrackGroup) {
+			g.groups = append(g.groups, group)
+			g.save()
+		})
+	})
+	addDrumsBtn := widget.NewButtonWithIcon("Add Drums", theme.ContentAddIcon(), func() {
+		appLog.Debugf("Opening add drum group dialog")
+		g.showEditDialog(defaultDrumGroup(), func(group TrackGroup) {
+			g.groups = append(g.groups, group)
+			g.save()
+		})
+	})
+	editBtn := widget.NewButtonWithIcon("Edit", theme.DocumentCreateIcon(), func() {
+		if g.selected < 0 {
+			return
+		}
+		appLog.Debugf("Opening edit group dialog for %v", g.groups[g.selected].Name)
+		i := g.selected
+		g.showEditDialog(g.groups[i], func(group TrackGroup) {
+			g.groups[i] = group
+			g.save()
+		})
+	})
+	removeBtn := widget.NewButtonWithIcon("Remove", theme.ContentRemoveIcon(), func() {
+		if g.selected < 0 {
+			return
+		}
+		appLog.Debugf("Removing group %v", g.groups[g.selected].Name)
+		g.groups = append(g.groups[:g.selected], g.groups[g.selected+1:]...)
+		g.list.UnselectAll()
+		g.save()
+	})
+	upBtn := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+		g.move(-1)
+	})
+	downBtn := widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() {
+		g.move(1)
+	})
+	g.buttons = []*widget.Button{addBtn, addDrumsBtn, editBtn, removeBtn, upBtn, downBtn}
+
+	return container.NewBorder(
+		widget.NewLabel("Track Groups:"),
+		container.NewHBox(addBtn, addDrumsBtn, editBtn, removeBtn, upBtn, downBtn),
+		nil,
+		nil,
+		g.list,
+	)
+}
+
+func (g *groupList) move(offset int) {
+	to := g.selected + offset
+	if g.selected < 0 || to < 0 || to >= len(g.groups) {
+		return
+	}
+
+	g.groups[g.selected], g.groups[to] = g.groups[to], g.groups[g.selected]
+	g.save()
+	g.list.Select(to)
+}
+
+func (g *groupList) Disable() {
+	for _, b := range g.buttons {
+		b.Disable()
+	}
+}
+
+func (g *groupList) Enable() {
+	for _, b := range g.buttons {
+		b.Enable()
+	}
+}
+
+func (g *groupList) showEditDialog(group TrackGroup, onSave func(TrackGroup)) {
+	nameTXT := widget.NewEntry()
+	nameTXT.SetText(group.Name)
+	countTXT := createNumberInput(0, 65535)
+	countTXT.SetText(strconv.Itoa(group.Count))
+	channelsTXT := widget.NewEntry()
+	channelsTXT.Validator = validateChannels
+	channelsTXT.SetText(group.Channels)
+	programTXT := createNumberInput(0, 127)
+	programTXT.SetText(strconv.Itoa(group.Program))
+	nameFormatTXT := widget.NewEntry()
+	nameFormatTXT.SetPlaceHolder("e.g. {group} {n}")
+	nameFormatTXT.SetText(group.NameFormat)
+	drumsChk := widget.NewCheck("Allow Drums channel?", func(bool) {})
+	drumsChk.Checked = group.AllowDrums
+	drumGroupChk := widget.NewCheck("Drum group?", func(bool) {})
+	drumGroupChk.Checked = group.Drums
+	drumModeSel := widget.NewSelect(drumModes, func(string) {})
+	drumModeSel.SetSelected("gm")
+	if group.DrumMode != "" {
+		drumModeSel.SetSelected(strings.ToLower(group.DrumMode))
+	}
+	drumNamesChk := widget.NewCheck("Name tracks after percussion parts?", func(bool) {})
+	drumNamesChk.Checked = group.DrumNames
+
+	dialog.ShowForm("Track Group", "Save", "Cancel", []*widget.FormItem{
+		{
+			Text:   "Name",
+			Widget: nameTXT,
+		},
+		{
+			Text:     "Tracks",
+			Widget:   countTXT,
+			HintText: "The number of tracks to create",
+		},
+		{
+			Text:     "Channels",
+			Widget:   channelsTXT,
+			HintText: "The channels to create tracks on, e.g. 1-15 or 1,3,5-8. auto picks channels an existing file does not use, auto-port may also use another port",
+		},
+		{
+			Text:     "Program",
+			Widget:   programTXT,
+			HintText: "The instrument (0-127) set on each track. For drums: 0 Standard, 8 Room, 16 Power, 24 Electronic, 25 TR-808, 32 Jazz, 40 Brush, 48 Orchestra",
+		},
+		{
+			Text:     "Track Names",
+			Widget:   nameFormatTXT,
+			HintText: "{group}, {n}, {ch} and {drum} are replaced. Leave empty for no names",
+		},
+		{
+			Text:     "CH-10",
+			Widget:   drumsChk,
+			HintText: "If unchecked, channel 10 will be skipped",
+		},
+		{
+			Text:     "Drums",
+			Widget:   drumGroupChk,
+			HintText: "Drum groups use channel 10 and a drum kit program",
+		},
+		{
+			Text:     "Drum Mode",
+			Widget:   drumModeSel,
+			HintText: "gm uses channel 10 only, gs and xg declare the group's channels as drum parts",
+		},
+		{
+			Text:     "Drum Names",
+			Widget:   drumNamesChk,
+			HintText: "Used when Track Names is empty",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		count, _ := strconv.Atoi(countTXT.Text)
+		program, _ := strconv.Atoi(programTXT.Text)
+		edited := TrackGroup{
+			Name:       nameTXT.Text,
+			Count:      count,
+			Channels:   channelsTXT.Text,
+			Program:    program,
+			NameFormat: nameFormatTXT.Text,
+			AllowDrums: drumsChk.Checked,
+			Drums:      drumGroupChk.Checked,
+			DrumMode:   drumModeSel.Selected,
+			DrumNames:  drumNamesChk.Checked,
+		}
+		if err := edited.Validate(); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+
+		appLog.Debugf("Group %v saved", edited.Name)
+		onSave(edited)
+	}, g.window)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	sqdialog "github.com/sqweek/dialog"
+)
+
+// how often the output view checks for new lines, so a burst of lines
+// (e.g. one per track of a 65535 track run) is redrawn once instead of per line
+const outputRefreshInterval = 100 * time.Millisecond
+
+// outputView is the log at the bottom of the main window
+// only the rows on screen are drawn, so it stays fast however long the log gets
+type outputView struct {
+	history *logHistory
+	mu      sync.Mutex // guards shown and filter, the list reads them while drawing
+	shown   []logLine
+	filter  Level
+
+	prefs   fyne.Preferences
+	window  fyne.Window
+	list    *widget.List
+	dropped *widget.Label
+
+	ticker *time.Ticker
+	stop   chan struct{} // closed by Close to end the refresh goroutine
+}
+
+func newOutputView(prefs fyne.Preferences, window fyne.Window) *outputView {
+	o := &outputView{
+		history: newLogHistory(maxOutputLines),
+		prefs:   prefs,
+		window:  window,
+		dropped: widget.NewLabel(""),
+		ticker:  time.NewTicker(outputRefreshInterval),
+		stop:    make(chan struct{}),
+	}
+	o.filter, _ = parseLevel(prefs.StringWithFallback("outputFilter", "debug"))
+	o.dropped.Hide()
+
+	o.list = widget.NewList(
+		func() int {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			return len(o.shown)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			o.mu.Lock()
+			if id >= len(o.shown) {
+				o.mu.Unlock()
+				return
+			}
+			line := o.shown[id]
+			o.mu.Unlock()
+
+			label := item.(*widget.Label)
+			label.SetText(line.Text)
+			label.TextStyle = fyne.TextStyle{Monospace: true, Bold: line.Level >= LevelWarn}
+			label.Refresh()
+		},
+	)
+
+	go func() {
+		for {
+			select {
+			case <-o.ticker.C:
+				if o.history.takeChanged() {
+					o.refresh()
+				}
+			case <-o.stop:
+				return
+			}
+		}
+	}()
+
+	return o
+}
+
+func (o *outputView) refresh() {
+	o.mu.Lock()
+	o.shown = o.history.Lines(o.filter)
+	o.mu.Unlock()
+
+	if dropped := o.history.Dropped(); dropped > 0 {
+		o.dropped.SetText(fmt.Sprintf("%v earlier lines are not shown, save the log to see every line", dropped))
+		o.dropped.Show()
+	} else {
+		o.dropped.Hide()
+	}
+
+	o.list.Refresh()
+	o.list.ScrollToBottom()
+}
+
+// Clear empties the view and the saved history, e.g. before a new run
+func (o *outputView) Clear() {
+	o.history.Clear()
+	o.refresh()
+}
+
+func (o *outputView) save() {
+	filePath, err := sqdialog.File().Filter("Log Files (.log)", "log").Title("Save Log").Save()
+	if errors.Is(err, sqdialog.ErrCancelled) {
+		appLog.Debugf("User cancelled save log dialog")
+		return // user cancelled
+	} else if err != nil {
+		showFileDialogError("save log", err)
+		return
+	}
+
+	if err := o.history.Save(filePath); err != nil {
+		appLog.Errorf("could not save the log: %v", err)
+		dialog.ShowError(err, o.window)
+		return
+	}
+	appLog.Infof("saved the log to %v", filePath)
+}
+
+func (o *outputView) content() fyne.CanvasObject {
+	filterSel := widget.NewSelect(logLevels, func(s string) {
+		o.mu.Lock()
+		o.filter, _ = parseLevel(s)
+		o.mu.Unlock()
+		o.prefs.SetString("outputFilter", s)
+		o.refresh()
+	})
+	filterSel.SetSelected(o.filter.String())
+
+	saveButton := widget.NewButtonWithIcon("Save Log...", theme.DocumentSaveIcon(), o.save)
+	clearButton := widget.NewButtonWithIcon("Clear", theme.ContentClearIcon(), o.Clear)
+
+	toolbar := container.NewHBox(widget.NewLabel("Show:"), filterSel, saveButton, clearButton)
+
+	return container.NewBorder(container.NewVBox(toolbar, o.dropped), nil, nil, nil, o.list)
+}
+
+// Close stops refreshing and removes the history file, call it when the window closes
+func (o *outputView) Close() {
+	o.ticker.Stop()
+	close(o.stop)
+	o.history.Close()
+}
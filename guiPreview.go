@@ -0,0 +1,372 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// how long the preview waits after the last change before planning again,
+// so typing in a field does not read the output file on every key
+const previewDelay = 300 * time.Millisecond
+
+// previewPanel shows the tracks Create would write, planned again whenever a field changes
+// the selected track can be edited, after which Create writes the edited plan
+// and the fields no longer replan it until Reset
+type previewPanel struct {
+	mu       sync.Mutex // guards everything up to the widgets, the table reads the plan while drawing
+	plan     *TrackPlan
+	planErr  error
+	timer    *time.Timer
+	pending  int // the newest planning, older plans that finish late are dropped
+	opts     CreateOptions
+	optsErr  error
+	stale    bool // the fields changed after the tracks were edited
+	selected int  // -1 when no track is selected
+	disabled bool
+
+	filling bool // the editor is being filled from the selected track, its callbacks are not edits
+
+	table      *widget.Table
+	summary    *widget.Label
+	nameTXT    *widget.Entry
+	channelSel *widget.Select
+	programTXT *widget.Entry
+	buttons    []*widget.Button // the track buttons, enabled while a track is selected
+	resetBtn   *widget.Button
+}
+
+func newPreviewPanel() *previewPanel {
+	p := &previewPanel{summary: widget.NewLabel(""), selected: -1}
+	p.summary.Wrapping = fyne.TextWrapWord
+
+	p.table = widget.NewTable(
+		func() (int, int) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if p.plan == nil {
+				return 0, len(planColumns)
+			}
+			return len(p.plan.Tracks), len(planColumns)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.TableCellID, cell fyne.CanvasObject) {
+			p.mu.Lock()
+			text := ""
+			if p.plan != nil && id.Row < len(p.plan.Tracks) {
+				text = p.plan.Tracks[id.Row].cell(id.Col)
+			}
+			p.mu.Unlock()
+			cell.(*widget.Label).SetText(text)
+		},
+	)
+	p.table.ShowHeaderRow = true
+	p.table.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	}
+	p.table.UpdateHeader = func(id widget.TableCellID, cell fyne.CanvasObject) {
+		if id.Col >= 0 {
+			name := planColumns[id.Col]
+			cell.(*widget.Label).SetText(strings.ToUpper(name[:1]) + name[1:])
+		}
+	}
+	p.table.OnSelected = func(id widget.TableCellID) {
+		p.mu.Lock()
+		p.selected = id.Row
+		p.mu.Unlock()
+		p.fillEditor()
+	}
+	p.table.OnUnselected = func(widget.TableCellID) {
+		p.mu.Lock()
+		p.selected = -1
+		p.mu.Unlock()
+		p.fillEditor()
+	}
+
+	widths := []float32{60, 100, 200, 70, 50, 140}
+	for col, width := range widths {
+		p.table.SetColumnWidth(col, width)
+	}
+
+	p.createEditor()
+	p.fillEditor()
+
+	return p
+}
+
+func (p *previewPanel) createEditor() {
+	p.nameTXT = widget.NewEntry()
+	p.nameTXT.SetPlaceHolder("track name")
+	p.nameTXT.OnChanged = func(name string) {
+		p.edit(false, func(plan *TrackPlan, i int) (int, error) {
+			plan.rename(i, name)
+			return i, nil
+		})
+	}
+
+	var channels []string
+	for ch := 1; ch <= 16; ch++ {
+		channels = append(channels, strconv.Itoa(ch))
+	}
+	p.channelSel = widget.NewSelect(channels, func(s string) {
+		channel, _ := strconv.Atoi(s)
+		p.edit(false, func(plan *TrackPlan, i int) (int, error) {
+			return i, plan.setChannel(i, channel)
+		})
+	})
+
+	p.programTXT = createNumberInput(0, 127)
+	p.programTXT.OnChanged = func(s string) {
+		if p.programTXT.Validate() != nil {
+			return // wait until it is a program number
+		}
+		program, _ := strconv.Atoi(s)
+		p.edit(false, func(plan *TrackPlan, i int) (int, error) {
+			return i, plan.setProgram(i, program)
+		})
+	}
+
+	upBtn := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+		p.edit(true, func(plan *TrackPlan, i int) (int, error) {
+			if i == 0 {
+				return i, nil
+			}
+			plan.move(i, i-1)
+			return i - 1, nil
+		})
+	})
+	downBtn := widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() {
+		p.edit(true, func(plan *TrackPlan, i int) (int, error) {
+			if i == len(plan.Tracks)-1 {
+				return i, nil
+			}
+			plan.move(i, i+1)
+			return i + 1, nil
+		})
+	})
+	duplicateBtn := widget.NewButtonWithIcon("Duplicate", theme.ContentCopyIcon(), func() {
+		p.edit(true, func(plan *TrackPlan, i int) (int, error) {
+			plan.duplicate(i)
+			return i + 1, nil
+		})
+	})
+	deleteBtn := widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), func() {
+		p.edit(true, func(plan *TrackPlan, i int) (int, error) {
+			plan.delete(i)
+			return -1, nil
+		})
+	})
+	p.buttons = []*widget.Button{upBtn, downBtn, duplicateBtn, deleteBtn}
+
+	p.resetBtn = widget.NewButtonWithIcon("Reset", theme.ViewRefreshIcon(), p.Reset)
+}
+
+// edit changes the selected track, fn returns the row to select after it (-1 for none)
+// refill is false for edits made in the editor fields, refilling them would move the cursor
+func (p *previewPanel) edit(refill bool, fn func(plan *TrackPlan, i int) (int, error)) {
+	p.mu.Lock()
+	if p.filling || p.plan == nil || p.selected < 0 || p.selected >= len(p.plan.Tracks) {
+		p.mu.Unlock()
+		return
+	}
+	selected, err := fn(p.plan, p.selected)
+	p.mu.Unlock()
+
+	if err != nil {
+		appLog.Warnf("could not edit the track: %v", err)
+		return
+	}
+	p.refresh()
+
+	if !refill {
+		return
+	}
+	if selected < 0 {
+		p.table.UnselectAll()
+	} else {
+		p.table.Select(widget.TableCellID{Row: selected, Col: 2})
+	}
+	p.fillEditor()
+}
+
+// fillEditor shows the selected track in the editor fields
+func (p *previewPanel) fillEditor() {
+	p.mu.Lock()
+	var track *PlannedTrack
+	if p.plan != nil && p.selected >= 0 && p.selected < len(p.plan.Tracks) {
+		t := p.plan.Tracks[p.selected]
+		track = &t
+	}
+	edited := p.plan != nil && p.plan.Edited
+	disabled := p.disabled
+	p.filling = true
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.filling = false
+		p.mu.Unlock()
+	}()
+
+	inputs := []fyne.Disableable{p.nameTXT, p.channelSel, p.programTXT}
+	for _, b := range p.buttons {
+		inputs = append(inputs, b)
+	}
+	for _, input := range inputs {
+		if track == nil || disabled {
+			input.Disable()
+		} else {
+			input.Enable()
+		}
+	}
+	if edited && !disabled {
+		p.resetBtn.Enable()
+	} else {
+		p.resetBtn.Disable()
+	}
+
+	if track == nil {
+		p.nameTXT.SetText("")
+		p.channelSel.ClearSelected()
+		p.programTXT.SetText("")
+		return
+	}
+	p.nameTXT.SetText(track.Name)
+	p.channelSel.SetSelected(strconv.Itoa(track.Channel))
+	p.programTXT.SetText(strconv.Itoa(track.Program))
+}
+
+// refresh redraws the table and the summary after the plan changed
+func (p *previewPanel) refresh() {
+	p.mu.Lock()
+	var text string
+	switch {
+	case p.plan != nil:
+		text = p.plan.Summary()
+		if p.stale {
+			text += ". The fields changed since the tracks were edited, Reset plans them again"
+		}
+	case p.planErr != nil:
+		text = "Nothing to preview: " + p.planErr.Error()
+	default:
+		text = "Planning..."
+	}
+	p.mu.Unlock()
+
+	p.summary.SetText(text)
+	p.table.Refresh()
+}
+
+// schedule plans again once the fields stop changing
+// err is why the options are not valid, it is shown instead of planning
+// an edited plan is kept, the options are used when it is reset
+func (p *previewPanel) schedule(opts CreateOptions, err error) {
+	p.mu.Lock()
+	p.opts, p.optsErr = opts, err
+	if p.plan != nil && p.plan.Edited {
+		p.stale = true
+		p.mu.Unlock()
+		p.refresh()
+		return
+	}
+	p.mu.Unlock()
+
+	p.planAfter(previewDelay)
+}
+
+func (p *previewPanel) planAfter(delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending++
+	pending := p.pending
+	opts, err := p.opts, p.optsErr
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(delay, func() {
+		var plan *TrackPlan
+		if err == nil {
+			// no logger, planning every few keys would fill the output
+			plan, err = PlanMIDI(opts, nil)
+		}
+
+		p.mu.Lock()
+		// a plan edited while this one was made is kept
+		if pending != p.pending || (p.plan != nil && p.plan.Edited) {
+			p.mu.Unlock()
+			return
+		}
+		p.plan, p.planErr = plan, err
+		p.selected = -1
+		p.mu.Unlock()
+
+		p.table.UnselectAll()
+		p.refresh()
+		p.fillEditor()
+	})
+}
+
+// Reset drops the edits and plans again with the latest fields,
+// e.g. after the tracks were written and the file changed
+func (p *previewPanel) Reset() {
+	p.mu.Lock()
+	p.plan, p.planErr = nil, nil
+	p.stale = false
+	p.selected = -1
+	p.mu.Unlock()
+
+	p.table.UnselectAll()
+	p.refresh()
+	p.fillEditor()
+	p.planAfter(0)
+}
+
+// editedPlan is a copy of the plan if it was edited, nil if Create should plan the tracks itself
+func (p *previewPanel) editedPlan() *TrackPlan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.plan == nil || !p.plan.Edited {
+		return nil
+	}
+	return p.plan.clone()
+}
+
+func (p *previewPanel) Disable() {
+	p.mu.Lock()
+	p.disabled = true
+	p.mu.Unlock()
+	p.fillEditor()
+}
+
+func (p *previewPanel) Enable() {
+	p.mu.Lock()
+	p.disabled = false
+	p.mu.Unlock()
+	p.fillEditor()
+}
+
+func (p *previewPanel) content() fyne.CanvasObject {
+	editor := container.NewBorder(
+		nil,
+		nil,
+		widget.NewLabel("Track:"),
+		container.NewHBox(
+			widget.NewLabel("Channel:"), p.channelSel,
+			widget.NewLabel("Program:"), p.programTXT,
+			p.buttons[0], p.buttons[1], p.buttons[2], p.buttons[3], p.resetBtn,
+		),
+		p.nameTXT,
+	)
+
+	return container.NewBorder(container.NewVBox(p.summary, editor), nil, nil, nil, p.table)
+}
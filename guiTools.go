@@ -0,0 +1,593 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	sqdialog "github.com/sqweek/dialog"
+)
+
+// the Tools menu holds operations on existing MIDI files
+// each one logs to the output box like the Create button does
+func createToolsMenu(window fyne.Window, logger *Logger) *fyne.Menu {
+	return fyne.NewMenu("Tools",
+		fyne.NewMenuItem("Inspect File...", func() {
+			inspectWithDialog(window, logger)
+		}),
+		fyne.NewMenuItem("Statistics...", func() {
+			statsWithDialog(window, logger)
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Remove Tracks...", func() {
+			showRemoveDialog(window, logger)
+		}),
+		fyne.NewMenuItem("Purge Empty Tracks...", func() {
+			showPurgeDialog(window, logger)
+		}),
+		fyne.NewMenuItem("Remap Channels...", func() {
+			showRemapDialog(window, logger)
+		}),
+		fyne.NewMenuItem("Compact File...", func() {
+			showCompactDialog(window, logger)
+		}),
+		fyne.NewMenuItem("Change PPQ...", func() {
+			showResampleDialog(window, logger)
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Merge Files...", func() {
+			showMergeDialog(window, logger)
+		}),
+		fyne.NewMenuItem("Split File...", func() {
+			showSplitDialog(window, logger)
+		}),
+		fyne.NewMenuItem("Join Files in Time...", func() {
+			showConcatDialog(window, logger)
+		}),
+	)
+}
+
+// runningStatusPref is the running status setting, every file the tools write follows it
+func runningStatusPref() bool {
+	return fyne.CurrentApp().Preferences().Bool("runningStatus")
+}
+
+// showFileDialogError tells the user a file picker could not be opened,
+// the pickers are native so this uses a native message box too
+func showFileDialogError(title string, err error) {
+	appLog.Debugf("could not open %v dialog: %v", title, err)
+	sqdialog.Message("Could not open the file dialog: %v", err).Title("Error").Error()
+}
+
+// createFileInput is an entry with a button that opens a MIDI file dialog
+func createFileInput(title string) (*widget.Entry, fyne.CanvasObject) {
+	entry := widget.NewEntry()
+	entry.Validator = func(s string) error {
+		if s == "" {
+			return errors.New("path cannot be empty")
+		}
+		return nil
+	}
+
+	button := widget.NewButtonWithIcon("", theme.FileIcon(), func() {
+		appLog.Debugf("Opening %v dialog", title)
+
+		filePath, err := sqdialog.File().Filter("MIDI Files (.mid)", "mid").Title(title).Load()
+		if errors.Is(err, sqdialog.ErrCancelled) {
+			appLog.Debugf("User cancelled %v dialog", title)
+			return // user cancelled
+		} else if err != nil {
+			showFileDialogError(title, err)
+			return
+		}
+
+		entry.SetText(filePath)
+	})
+
+	return entry, container.NewBorder(nil, nil, nil, button, entry)
+}
+
+// createFileListInput is a multi line entry of paths, one per line,
+// with a button that adds a MIDI file to the list
+func createFileListInput(title string) (*widget.Entry, fyne.CanvasObject) {
+	entry := widget.NewMultiLineEntry()
+	entry.SetMinRowsVisible(4)
+	entry.SetPlaceHolder("one file per line")
+
+	button := widget.NewButtonWithIcon("Add File", theme.ContentAddIcon(), func() {
+		appLog.Debugf("Opening %v dialog", title)
+
+		filePath, err := sqdialog.File().Filter("MIDI Files (.mid)", "mid").Title(title).Load()
+		if errors.Is(err, sqdialog.ErrCancelled) {
+			appLog.Debugf("User cancelled %v dialog", title)
+			return // user cancelled
+		} else if err != nil {
+			showFileDialogError(title, err)
+			return
+		}
+
+		if entry.Text != "" && !strings.HasSuffix(entry.Text, "\n") {
+			entry.SetText(entry.Text + "\n")
+		}
+		entry.SetText(entry.Text + filePath)
+	})
+
+	return entry, container.NewBorder(nil, container.NewHBox(button), nil, nil, entry)
+}
+
+func fileList(s string) []string {
+	var paths []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+
+	return paths
+}
+
+// createOutputInput is an entry with a button that opens a save dialog
+func createOutputInput(title string) (*widget.Entry, fyne.CanvasObject) {
+	entry := widget.NewEntry()
+	entry.Validator = func(s string) error {
+		if s == "" {
+			return errors.New("path cannot be empty")
+		}
+		if path.Ext(s) != ".mid" {
+			return errors.New("file must be a .mid file")
+		}
+		return nil
+	}
+
+	button := widget.NewButtonWithIcon("", theme.FileIcon(), func() {
+		appLog.Debugf("Opening %v dialog", title)
+
+		filePath, err := sqdialog.File().Filter("MIDI Files (.mid)", "mid").Title(title).Save()
+		if errors.Is(err, sqdialog.ErrCancelled) {
+			appLog.Debugf("User cancelled %v dialog", title)
+			return // user cancelled
+		} else if err != nil {
+			showFileDialogError(title, err)
+			return
+		}
+
+		// append .mid if not present
+		if !strings.HasSuffix(filePath, ".mid") {
+			filePath += ".mid"
+		}
+
+		entry.SetText(filePath)
+	})
+
+	return entry, container.NewBorder(nil, nil, nil, button, entry)
+}
+
+// inspectWithDialog asks for a file and writes its report to the output box
+func inspectWithDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening inspect file dialog")
+
+	filePath, err := sqdialog.File().Filter("MIDI Files (.mid)", "mid").Title("Select MIDI File").Load()
+	if errors.Is(err, sqdialog.ErrCancelled) {
+		logger.Debugf("User cancelled inspect file dialog")
+		return // user cancelled
+	} else if err != nil {
+		logger.Debugf("could not open inspect file dialog: %v", err)
+		dialog.ShowError(err, window)
+		return
+	}
+
+	report, err := InspectMIDIFile(filePath)
+	if err != nil {
+		logger.Errorf("could not inspect file: %v", err)
+		dialog.ShowError(err, window)
+		return
+	}
+
+	var table strings.Builder
+	report.writeTable(&table)
+	logger.Infof("%v", strings.TrimRight(table.String(), "\n"))
+}
+
+// statsWithDialog asks for a file and writes its statistics to the output box
+func statsWithDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening statistics dialog")
+
+	filePath, err := sqdialog.File().Filter("MIDI Files (.mid)", "mid").Title("Select MIDI File").Load()
+	if errors.Is(err, sqdialog.ErrCancelled) {
+		logger.Debugf("User cancelled statistics dialog")
+		return // user cancelled
+	} else if err != nil {
+		logger.Debugf("could not open statistics dialog: %v", err)
+		dialog.ShowError(err, window)
+		return
+	}
+
+	logger.Infof("analyzing %v", filePath)
+	stats, err := AnalyzeMIDIFile(filePath, logger)
+	if err != nil {
+		logger.Errorf("could not analyze file: %v", err)
+		dialog.ShowError(err, window)
+		return
+	}
+
+	var table strings.Builder
+	stats.writeTable(&table)
+	logger.Infof("%v", strings.TrimRight(table.String(), "\n"))
+}
+
+func showRemoveDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening remove tracks dialog")
+
+	fileTXT, fileInput := createFileInput("Select MIDI File")
+	indexesTXT := widget.NewEntry()
+	indexesTXT.SetPlaceHolder("e.g. 1,3,5-8")
+	indexesTXT.Validator = func(s string) error {
+		_, err := parseIndexList(s)
+		return err
+	}
+	nameTXT := widget.NewEntry()
+	nameTXT.SetPlaceHolder("e.g. Art*")
+	lastTXT := createNumberInput(0, 65535)
+	lastTXT.SetText("0")
+
+	dialog.ShowForm("Remove Tracks", "Remove", "Cancel", []*widget.FormItem{
+		{
+			Text:   "MIDI File",
+			Widget: fileInput,
+		},
+		{
+			Text:     "Indexes",
+			Widget:   indexesTXT,
+			HintText: "Track indexes to remove, 0 is the first (conductor) track",
+		},
+		{
+			Text:     "Name Pattern",
+			Widget:   nameTXT,
+			HintText: "Remove tracks whose name matches, * and ? are wildcards",
+		},
+		{
+			Text:     "Last Tracks",
+			Widget:   lastTXT,
+			HintText: "Remove the last N tracks, e.g. the ones added by the last run",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		indexes, _ := parseIndexList(indexesTXT.Text)
+		last, _ := strconv.Atoi(lastTXT.Text)
+		opts := RemoveOptions{
+			Indexes:     indexes,
+			NamePattern: strings.TrimSpace(nameTXT.Text),
+			Last:        last,
+		}
+
+		logger.Infof("removing tracks from %v", fileTXT.Text)
+		if err := RemoveMIDITracks(fileTXT.Text, fileTXT.Text, opts, logger); err != nil {
+			logger.Errorf("could not remove tracks: %v", err)
+			dialog.ShowError(err, window)
+		}
+	}, window)
+}
+
+func showPurgeDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening purge empty tracks dialog")
+
+	fileTXT, fileInput := createFileInput("Select MIDI File")
+	keepControlChk := widget.NewCheck("Keep tracks with controller/meta events?", func(bool) {})
+
+	dialog.ShowForm("Purge Empty Tracks", "Purge", "Cancel", []*widget.FormItem{
+		{
+			Text:   "MIDI File",
+			Widget: fileInput,
+		},
+		{
+			Text:     "Control Tracks",
+			Widget:   keepControlChk,
+			HintText: "If unchecked, every track without notes is removed",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		logger.Infof("purging empty tracks from %v", fileTXT.Text)
+		err := PurgeEmptyTracks(fileTXT.Text, fileTXT.Text, PurgeOptions{KeepControlTracks: keepControlChk.Checked}, logger)
+		if err != nil {
+			logger.Errorf("could not purge tracks: %v", err)
+			dialog.ShowError(err, window)
+		}
+	}, window)
+}
+
+func showMergeDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening merge files dialog")
+
+	filesTXT, filesInput := createFileListInput("Add MIDI File")
+	outputTXT, outputInput := createOutputInput("Select Output Path")
+	ppqTXT := createNumberInput(0, 32767)
+	ppqTXT.SetText("0")
+	conductorSel := widget.NewSelect([]string{"first file", "merge all"}, func(string) {})
+	conductorSel.SetSelected("first file")
+
+	dialog.ShowForm("Merge Files", "Merge", "Cancel", []*widget.FormItem{
+		{
+			Text:     "MIDI Files",
+			Widget:   filesInput,
+			HintText: "Format 1 files, their tracks are added in this order",
+		},
+		{
+			Text:   "Output",
+			Widget: outputInput,
+		},
+		{
+			Text:     "PPQ",
+			Widget:   ppqTXT,
+			HintText: "Files with a different PPQ are rescaled. 0 uses the first file's PPQ",
+		},
+		{
+			Text:     "Conductor",
+			Widget:   conductorSel,
+			HintText: "Keep the first file's conductor track, or merge every file's",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		paths := fileList(filesTXT.Text)
+		if len(paths) < 2 {
+			dialog.ShowError(errors.New("at least 2 files are needed to merge"), window)
+			return
+		}
+
+		ppq, _ := strconv.Atoi(ppqTXT.Text)
+		opts := MergeOptions{PPQ: ppq, RunningStatus: runningStatusPref()}
+		if conductorSel.Selected == "merge all" {
+			opts.Conductor = -1
+		}
+
+		logger.Infof("merging %v files into %v", len(paths), outputTXT.Text)
+		if err := MergeMIDIFiles(paths, outputTXT.Text, opts, logger); err != nil {
+			logger.Errorf("could not merge files: %v", err)
+			dialog.ShowError(err, window)
+		}
+	}, window)
+}
+
+func showSplitDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening split file dialog")
+
+	fileTXT, fileInput := createFileInput("Select MIDI File")
+	modeSel := widget.NewSelect(splitModes, func(string) {})
+	modeSel.SetSelected("channel")
+	valueTXT := widget.NewEntry()
+	valueTXT.SetPlaceHolder("e.g. 1-4,5-8 or Melody*,Art*")
+
+	dialog.ShowForm("Split File", "Split", "Cancel", []*widget.FormItem{
+		{
+			Text:     "MIDI File",
+			Widget:   fileInput,
+			HintText: "The files are written next to it, e.g. song_ch16.mid",
+		},
+		{
+			Text:     "Split By",
+			Widget:   modeSel,
+			HintText: "Track index ranges, channel, or track name patterns",
+		},
+		{
+			Text:     "Ranges/Names",
+			Widget:   valueTXT,
+			HintText: "One output file for each, separated by commas. Not used for channel",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		logger.Infof("splitting %v by %v", fileTXT.Text, modeSel.Selected)
+		err := SplitMIDIFile(fileTXT.Text, "", SplitOptions{Mode: modeSel.Selected, Value: valueTXT.Text}, logger)
+		if err != nil {
+			logger.Errorf("could not split file: %v", err)
+			dialog.ShowError(err, window)
+		}
+	}, window)
+}
+
+func showRemapDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening remap channels dialog")
+
+	fileTXT, fileInput := createFileInput("Select MIDI File")
+	rulesTXT := widget.NewMultiLineEntry()
+	rulesTXT.SetPlaceHolder("16:14\n1:2@1\n10:11/3,5-8")
+	rulesTXT.SetMinRowsVisible(4)
+	dryRunChk := widget.NewCheck("Only show what would be moved", func(bool) {})
+	dryRunChk.SetChecked(true)
+
+	dialog.ShowForm("Remap Channels", "Remap", "Cancel", []*widget.FormItem{
+		{
+			Text:   "MIDI File",
+			Widget: fileInput,
+		},
+		{
+			Text:     "Rules",
+			Widget:   rulesTXT,
+			HintText: "One per line, from:to, @port also sets the port, /tracks limits it to track indexes",
+		},
+		{
+			Text:   "Dry Run",
+			Widget: dryRunChk,
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		rules, err := parseChannelRules(rulesTXT.Text)
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+
+		logger.Infof("remapping channels of %v", fileTXT.Text)
+		if err := RemapChannels(fileTXT.Text, fileTXT.Text, RemapOptions{Rules: rules, DryRun: dryRunChk.Checked, RunningStatus: runningStatusPref()}, logger); err != nil {
+			logger.Errorf("could not remap channels: %v", err)
+			dialog.ShowError(err, window)
+		}
+	}, window)
+}
+
+func showCompactDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening compact file dialog")
+
+	fileTXT, fileInput := createFileInput("Select MIDI File")
+	expandChk := widget.NewCheck("Write every status byte instead", func(bool) {})
+
+	dialog.ShowForm("Compact File", "Rewrite", "Cancel", []*widget.FormItem{
+		{
+			Text:   "MIDI File",
+			Widget: fileInput,
+		},
+		{
+			Text:     "Expand",
+			Widget:   expandChk,
+			HintText: "For programs that can't read running status",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		logger.Infof("rewriting %v", fileTXT.Text)
+		if err := CompactMIDIFile(fileTXT.Text, fileTXT.Text, !expandChk.Checked, logger); err != nil {
+			logger.Errorf("could not rewrite file: %v", err)
+			dialog.ShowError(err, window)
+		}
+	}, window)
+}
+
+func showResampleDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening change ppq dialog")
+
+	fileTXT, fileInput := createFileInput("Select MIDI File")
+	ppqTXT := createNumberInput(1, 32767)
+	ppqTXT.SetText("960")
+	roundingSel := widget.NewSelect(roundingModes, func(string) {})
+	roundingSel.SetSelected("nearest")
+	minLengthTXT := createNumberInput(0, 32767)
+	minLengthTXT.SetText("0")
+
+	dialog.ShowForm("Change PPQ", "Change", "Cancel", []*widget.FormItem{
+		{
+			Text:   "MIDI File",
+			Widget: fileInput,
+		},
+		{
+			Text:     "PPQ",
+			Widget:   ppqTXT,
+			HintText: "The new resolution, every event is moved to match it",
+		},
+		{
+			Text:     "Rounding",
+			Widget:   roundingSel,
+			HintText: "How ticks between two of the new ticks are rounded",
+		},
+		{
+			Text:     "Min Note Length",
+			Widget:   minLengthTXT,
+			HintText: "Notes shorter than this many ticks are made longer. Notes never become 0 ticks long",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		ppq, _ := strconv.Atoi(ppqTXT.Text)
+		minLength, _ := strconv.Atoi(minLengthTXT.Text)
+		opts := ResampleOptions{PPQ: ppq, Rounding: roundingSel.Selected, MinNoteLength: minLength, RunningStatus: runningStatusPref()}
+
+		logger.Infof("changing the ppq of %v to %v", fileTXT.Text, ppq)
+		if err := ResampleMIDIFile(fileTXT.Text, fileTXT.Text, opts, logger); err != nil {
+			logger.Errorf("could not change ppq: %v", err)
+			dialog.ShowError(err, window)
+		}
+	}, window)
+}
+
+func showConcatDialog(window fyne.Window, logger *Logger) {
+	logger.Debugf("Opening concat files dialog")
+
+	filesTXT, filesInput := createFileListInput("Add MIDI File")
+	outputTXT, outputInput := createOutputInput("Select Output Path")
+	ppqTXT := createNumberInput(0, 32767)
+	ppqTXT.SetText("0")
+	alignSel := widget.NewSelect(concatAlignModes, func(string) {})
+	alignSel.SetSelected("index")
+	barsTXT := widget.NewEntry()
+	barsTXT.SetPlaceHolder("e.g. 17,33")
+
+	dialog.ShowForm("Join Files in Time", "Join", "Cancel", []*widget.FormItem{
+		{
+			Text:     "MIDI Files",
+			Widget:   filesInput,
+			HintText: "Format 1 files, in the order they are played",
+		},
+		{
+			Text:   "Output",
+			Widget: outputInput,
+		},
+		{
+			Text:     "PPQ",
+			Widget:   ppqTXT,
+			HintText: "Files with a different PPQ are rescaled. 0 uses the first file's PPQ",
+		},
+		{
+			Text:     "Align Tracks",
+			Widget:   alignSel,
+			HintText: "Join tracks with the same index or the same name",
+		},
+		{
+			Text:     "Start Bars",
+			Widget:   barsTXT,
+			HintText: "The bar each file after the first starts on. Empty starts each where the previous ends",
+		},
+	}, func(b bool) {
+		if !b {
+			return
+		}
+
+		paths := fileList(filesTXT.Text)
+		if len(paths) < 2 {
+			dialog.ShowError(errors.New("at least 2 files are needed to join"), window)
+			return
+		}
+
+		ppq, _ := strconv.Atoi(ppqTXT.Text)
+		opts := ConcatOptions{PPQ: ppq, Align: alignSel.Selected, RunningStatus: runningStatusPref()}
+		if strings.TrimSpace(barsTXT.Text) != "" {
+			for _, bar := range strings.Split(barsTXT.Text, ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(bar))
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("bar %v is not a number", bar), window)
+					return
+				}
+				opts.StartBars = append(opts.StartBars, n)
+			}
+		}
+
+		logger.Infof("joining %v files into %v", len(paths), outputTXT.Text)
+		if err := ConcatMIDIFiles(paths, outputTXT.Text, opts, logger); err != nil {
+			logger.Errorf("could not join files: %v", err)
+			dialog.ShowError(err, window)
+		}
+	}, window)
+}
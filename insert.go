@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// where new tracks go in an existing file
+//
+// end:           after the last track (the default)
+// after-track:   after the track with the given index, 0 being the first (conductor) track
+// after-channel: after the last track that has events on the given channel (1-16)
+var insertModes = []string{"end", "after-track", "after-channel"}
+
+type InsertPosition struct {
+	Mode  string `json:"mode"`
+	Value int    `json:"value"` // the track index or channel, not used by end
+}
+
+// insertIndex returns the index in file.tracks that new tracks are inserted at
+func insertIndex(file *midiFile, insert InsertPosition) (int, error) {
+	switch insert.Mode {
+	case "", "end":
+		return len(file.tracks), nil
+	case "after-track":
+		if insert.Value < 0 || insert.Value >= len(file.tracks) {
+			return 0, fmt.Errorf("track %v does not exist (file has tracks 0-%v)", insert.Value, len(file.tracks)-1)
+		}
+		return insert.Value + 1, nil
+	case "after-channel":
+		if insert.Value < 1 || insert.Value > 16 {
+			return 0, fmt.Errorf("channel %v is not between 1 and 16", insert.Value)
+		}
+
+		index := -1
+		for i, track := range file.tracks {
+			channels, err := trackChannels(track)
+			if err != nil {
+				return 0, fmt.Errorf("track %v: %w", i, err)
+			}
+			if channels[insert.Value] {
+				index = i
+			}
+		}
+
+		if index == -1 {
+			appLog.Debugf("no track uses channel %v, inserting at the end", insert.Value)
+			return len(file.tracks), nil
+		}
+		return index + 1, nil
+	default:
+		return 0, fmt.Errorf("unknown insert mode %v", insert.Mode)
+	}
+}
+
+// insertPremadeMidi rewrites the file with the new tracks inserted at the given position
+// and the conductor track changed by the conductor options
+func insertPremadeMidi(ctx context.Context, info MIDIInfo) error {
+	logger := info.logger
+
+	file, err := readMIDIFile(info.midiPath)
+	if err != nil {
+		return err
+	}
+
+	if err := rewriteConductor(file, info.conductor, logger); err != nil {
+		return err
+	}
+
+	newTracks, err := splitTrackChunks(info.tracks)
+	if err != nil {
+		return err
+	}
+
+	index, err := insertIndex(file, info.insert)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("inserting tracks", Field{"count", len(newTracks)}, trackField(index), Field{"of", len(file.tracks)})
+
+	tracks := make([][]byte, 0, len(file.tracks)+len(newTracks))
+	tracks = append(tracks, file.tracks[:index]...)
+	tracks = append(tracks, newTracks...)
+	tracks = append(tracks, file.tracks[index:]...)
+	file.tracks = tracks
+
+	return replaceFile(ctx, info.midiPath, info.writeProgress(file.size()), file.write)
+}
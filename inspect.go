@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+type TrackReport struct {
+	Index       int            `json:"index"`
+	Name        string         `json:"name"`
+	Channels    []int          `json:"channels"`
+	Program     int            `json:"program"` // first program change, -1 if there is none
+	EventCounts map[string]int `json:"eventCounts"`
+	Notes       int            `json:"notes"`
+	FirstTick   uint64         `json:"firstTick"`
+	LastTick    uint64         `json:"lastTick"`
+	Bytes       int            `json:"bytes"`
+}
+
+type InspectReport struct {
+	Path         string        `json:"path"`
+	Format       int           `json:"format"`
+	Division     int           `json:"division"`
+	HeaderTracks int           `json:"headerTracks"` // track count written in the header
+	FileTracks   int           `json:"fileTracks"`   // tracks actually in the file
+	Seconds      float64       `json:"seconds"`      // playback time of the whole file
+	EndPosition  string        `json:"endPosition"`  // bar:beat:tick of the last event
+	Tracks       []TrackReport `json:"tracks"`
+}
+
+// eventType names the kind of an event for the event counts
+func eventType(ev midiEvent) string {
+	switch {
+	case ev.status == 0xff:
+		return "meta"
+	case ev.status == 0xf0 || ev.status == 0xf7:
+		return "sysex"
+	case ev.isNoteOn():
+		return "noteOn"
+	case ev.isNoteOff():
+		return "noteOff"
+	}
+
+	switch ev.status & 0xf0 {
+	case 0xa0:
+		return "polyAftertouch"
+	case 0xb0:
+		return "controlChange"
+	case 0xc0:
+		return "programChange"
+	case 0xd0:
+		return "channelAftertouch"
+	default:
+		return "pitchBend"
+	}
+}
+
+// inspectTrack describes one track, its tempo and time signature events are added to tempoEvents
+func inspectTrack(index int, track []byte, tempoEvents *[]timedEvent) (TrackReport, error) {
+	report := TrackReport{
+		Index:       index,
+		Channels:    []int{},
+		Program:     -1,
+		EventCounts: map[string]int{},
+		Bytes:       len(track) + 8, // MTrk and size
+	}
+
+	var channels [17]bool
+	var tick uint64
+	first := true
+
+	er := newEventReader(bytes.NewReader(track))
+	for {
+		ev, err := er.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		tick += uint64(ev.delta)
+		if first {
+			report.FirstTick = tick
+			first = false
+		}
+		report.LastTick = tick
+
+		report.EventCounts[eventType(ev)]++
+		if ev.status == 0xff && (ev.meta == 0x51 || ev.meta == 0x58) {
+			ev.data = append([]byte{}, ev.data...)
+			*tempoEvents = append(*tempoEvents, timedEvent{tick: tick, midiEvent: ev})
+		}
+		if ev.isNoteOn() {
+			report.Notes++
+		}
+		if ch := ev.channel(); ch > 0 {
+			channels[ch] = true
+		}
+		if ev.status&0xf0 == 0xc0 && report.Program == -1 {
+			report.Program = int(ev.data[0])
+		}
+		if ev.status == 0xff && ev.meta == 0x03 && report.Name == "" {
+			report.Name = string(ev.data)
+		}
+	}
+
+	for ch, used := range channels {
+		if used {
+			report.Channels = append(report.Channels, ch)
+		}
+	}
+
+	return report, nil
+}
+
+func inspectFile(path string, file *midiFile) (*InspectReport, error) {
+	report := &InspectReport{
+		Path:         path,
+		Format:       file.header.format,
+		Division:     file.header.division,
+		HeaderTracks: file.header.trackCount,
+		FileTracks:   len(file.tracks),
+	}
+
+	var tempoEvents []timedEvent
+	var end uint64
+	for i, track := range file.tracks {
+		trackReport, err := inspectTrack(i, track, &tempoEvents)
+		if err != nil {
+			return nil, fmt.Errorf("track %v: %w", i, err)
+		}
+		report.Tracks = append(report.Tracks, trackReport)
+		if trackReport.LastTick > end {
+			end = trackReport.LastTick
+		}
+	}
+
+	if checkDivision(path, file.header) == nil {
+		tempo := tempoMapFromEvents(file.header.division, tempoEvents)
+		report.Seconds = tempo.TickToSeconds(end)
+		report.EndPosition = tempo.TickToBarBeat(end).String()
+	}
+
+	return report, nil
+}
+
+// InspectMIDIFile reads the file and describes its header and every track
+func InspectMIDIFile(path string) (*InspectReport, error) {
+	file, err := readMIDIFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return inspectFile(path, file)
+}
+
+func joinInts(values []int) string {
+	var parts []string
+	for _, v := range values {
+		parts = append(parts, fmt.Sprint(v))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// writeTable writes the report as a table for people to read
+func (r *InspectReport) writeTable(w io.Writer) error {
+	fmt.Fprintf(w, "file:     %v\n", r.Path)
+	fmt.Fprintf(w, "format:   %v\n", r.Format)
+	fmt.Fprintf(w, "division: %v\n", r.Division)
+	fmt.Fprintf(w, "tracks:   %v in header, %v in file\n", r.HeaderTracks, r.FileTracks)
+	if r.EndPosition != "" {
+		fmt.Fprintf(w, "length:   %.2fs, ends at %v\n", r.Seconds, r.EndPosition)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tname\tchannels\tprogram\tnotes\tevents\tfirst tick\tlast tick\tbytes")
+	for _, t := range r.Tracks {
+		var types []string
+		for name := range t.EventCounts {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+
+		var events []string
+		for _, name := range types {
+			events = append(events, fmt.Sprintf("%v:%v", name, t.EventCounts[name]))
+		}
+
+		program := "-"
+		if t.Program >= 0 {
+			program = fmt.Sprint(t.Program)
+		}
+
+		fmt.Fprintf(tw, "%v\t%q\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			t.Index, t.Name, joinInts(t.Channels), program, t.Notes, strings.Join(events, " "), t.FirstTick, t.LastTick, t.Bytes)
+	}
+
+	return tw.Flush()
+}
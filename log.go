@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// every log line goes through a Logger, which passes it to each sink that
+// wants its level
+//
+// debug: what the program is doing, for finding bugs (used to be logf)
+// info:  what the user asked for is happening (used to be the logger func)
+// warn:  something was skipped or guessed, the result may not be what was expected
+// error: something failed
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return logLevels[l]
+}
+
+func parseLevel(s string) (Level, error) {
+	for i, name := range logLevels {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %v (want %v)", s, strings.Join(logLevels, ", "))
+}
+
+// Field is a key and value that is logged with a message
+type Field struct {
+	Key   string
+	Value any
+}
+
+// the fields most lines are about
+func trackField(index int) Field     { return Field{"track", index} }
+func channelField(channel int) Field { return Field{"channel", channel} }
+func groupField(name string) Field   { return Field{"group", name} }
+
+// Record is one log line
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  []Field
+}
+
+// Text is the message followed by the fields as key=value
+func (r Record) Text() string {
+	if len(r.Fields) == 0 {
+		return r.Message
+	}
+
+	var sb strings.Builder
+	sb.WriteString(r.Message)
+	for _, f := range r.Fields {
+		value := fmt.Sprint(f.Value)
+		if strings.ContainsAny(value, " \t\"=") || value == "" {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&sb, " %v=%v", f.Key, value)
+	}
+
+	return sb.String()
+}
+
+// String is the full line with the time and level, as written to files
+func (r Record) String() string {
+	return fmt.Sprintf("%v %-5v %v", r.Time.Format("15:04:05.000"), strings.ToUpper(r.Level.String()), r.Text())
+}
+
+// LogSink is somewhere log lines go, e.g. the output box of the gui
+type LogSink interface {
+	Log(r Record)
+}
+
+// SinkFunc lets a function be used as a sink
+type SinkFunc func(r Record)
+
+func (f SinkFunc) Log(r Record) {
+	f(r)
+}
+
+// writerSink writes each record as a line, formatted with format
+type writerSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format func(r Record) string
+}
+
+func (s *writerSink) Log(r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.w, s.format(r))
+}
+
+// newStderrSink writes full lines to stderr
+// (not stdout, android only sends stderr to logcat)
+func newStderrSink() LogSink {
+	return &writerSink{w: os.Stderr, format: Record.String}
+}
+
+// consoleSink writes only the message and fields, for the cli
+// info lines are the normal output and go to out, the rest goes to errOut
+// so that e.g. the JSON of stats -json stays readable
+type consoleSink struct {
+	out    writerSink
+	errOut writerSink
+}
+
+func newConsoleSink(out io.Writer, errOut io.Writer) LogSink {
+	return &consoleSink{
+		out:    writerSink{w: out, format: Record.Text},
+		errOut: writerSink{w: errOut, format: levelText},
+	}
+}
+
+func (s *consoleSink) Log(r Record) {
+	if r.Level == LevelInfo {
+		s.out.Log(r)
+	} else {
+		s.errOut.Log(r)
+	}
+}
+
+// levelText is the text with the level in front, except for info
+// which is what the user expects to see
+func levelText(r Record) string {
+	if r.Level == LevelInfo {
+		return r.Text()
+	}
+	return r.Level.String() + ": " + r.Text()
+}
+
+// fileSink appends full lines to a file
+type fileSink struct {
+	writerSink
+	file *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, ioError("open", path, err)
+	}
+
+	return &fileSink{writerSink: writerSink{w: file, format: Record.String}, file: file}, nil
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// levelSink only passes on records at or above its level,
+// the level can be changed while logging, e.g. from the settings
+type levelSink struct {
+	mu    sync.RWMutex
+	level Level
+	sink  LogSink
+}
+
+func (s *levelSink) setLevel(level Level) {
+	s.mu.Lock()
+	s.level = level
+	s.mu.Unlock()
+}
+
+func (s *levelSink) enabled(level Level) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return level >= s.level
+}
+
+// Logger sends records to its sinks, a nil or empty logger drops everything
+type Logger struct {
+	sinks  *[]*levelSink // shared by loggers made with With
+	mu     *sync.RWMutex
+	fields []Field
+}
+
+func NewLogger() *Logger {
+	return &Logger{sinks: &[]*levelSink{}, mu: &sync.RWMutex{}}
+}
+
+// AddSink sends every record at level or above to sink,
+// the returned function changes the level later
+func (l *Logger) AddSink(level Level, sink LogSink) func(Level) {
+	s := &levelSink{level: level, sink: sink}
+
+	l.mu.Lock()
+	*l.sinks = append(*l.sinks, s)
+	l.mu.Unlock()
+
+	return s.setLevel
+}
+
+// RemoveSink stops sending records to sink
+func (l *Logger) RemoveSink(sink LogSink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// a new slice, records being logged may still be reading the old one
+	var kept []*levelSink
+	for _, s := range *l.sinks {
+		if s.sink != sink {
+			kept = append(kept, s)
+		}
+	}
+	*l.sinks = kept
+}
+
+// With returns a logger that adds fields to every record,
+// it logs to the same sinks as l
+func (l *Logger) With(fields ...Field) *Logger {
+	if l == nil {
+		return nil
+	}
+
+	all := make([]Field, 0, len(l.fields)+len(fields))
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+
+	return &Logger{sinks: l.sinks, mu: l.mu, fields: all}
+}
+
+// Enabled reports whether any sink wants records at level,
+// so lines that are expensive to build can be skipped
+func (l *Logger) Enabled(level Level) bool {
+	if l == nil || l.sinks == nil {
+		return false
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, s := range *l.sinks {
+		if s.enabled(level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	if l == nil || l.sinks == nil {
+		return
+	}
+
+	l.mu.RLock()
+	sinks := *l.sinks
+	l.mu.RUnlock()
+
+	var r *Record
+	for _, s := range sinks {
+		if !s.enabled(level) {
+			continue
+		}
+		if r == nil {
+			r = &Record{Time: time.Now(), Level: level, Message: msg, Fields: append(append([]Field{}, l.fields...), fields...)}
+		}
+		s.sink.Log(*r)
+	}
+}
+
+func (l *Logger) logf(level Level, format string, a []any) {
+	if l.Enabled(level) {
+		l.log(level, fmt.Sprintf(format, a...), nil)
+	}
+}
+
+func (l *Logger) Debug(msg string, fields ...Field) { l.log(LevelDebug, msg, fields) }
+func (l *Logger) Info(msg string, fields ...Field)  { l.log(LevelInfo, msg, fields) }
+func (l *Logger) Warn(msg string, fields ...Field)  { l.log(LevelWarn, msg, fields) }
+func (l *Logger) Error(msg string, fields ...Field) { l.log(LevelError, msg, fields) }
+
+func (l *Logger) Debugf(format string, a ...any) { l.logf(LevelDebug, format, a) }
+func (l *Logger) Infof(format string, a ...any)  { l.logf(LevelInfo, format, a) }
+func (l *Logger) Warnf(format string, a ...any)  { l.logf(LevelWarn, format, a) }
+func (l *Logger) Errorf(format string, a ...any) { l.logf(LevelError, format, a) }
+
+// appLog is the logger of the whole program, the gui and cli add their sinks to it
+var appLog = NewLogger()
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// how many lines the output view keeps, older lines are dropped
+// (they are still in the history file, so saving the log keeps them)
+const maxOutputLines = 10000
+
+// logLine is one line of the output view, a record with several lines
+// (e.g. the inspect table) becomes several logLines
+type logLine struct {
+	Level Level
+	Text  string
+}
+
+// logHistory is the sink behind the output view
+//
+// the last lines are kept in a ring buffer so adding a line never copies the
+// whole log, and every record is also written to a temporary file so the full
+// log can be saved after the ring has dropped the start of it
+type logHistory struct {
+	mu      sync.Mutex
+	lines   []logLine
+	start   int // index of the oldest line in lines
+	count   int
+	dropped int
+	changed bool
+
+	file *os.File // nil if the file could not be created
+	w    *bufio.Writer
+}
+
+func newLogHistory(capacity int) *logHistory {
+	h := &logHistory{lines: make([]logLine, capacity)}
+
+	file, err := os.CreateTemp("", "empty-track-creator-*.log")
+	if err != nil {
+		appLog.Debugf("could not create the log history file, only the last %v lines can be saved: %v", capacity, err)
+	} else {
+		h.file = file
+		h.w = bufio.NewWriter(file)
+	}
+
+	return h
+}
+
+func (h *logHistory) Log(r Record) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, text := range strings.Split(levelText(r), "\n") {
+		h.push(logLine{Level: r.Level, Text: text})
+	}
+	if h.file != nil {
+		fmt.Fprintln(h.w, r.String())
+	}
+	h.changed = true
+}
+
+func (h *logHistory) push(line logLine) {
+	if len(h.lines) == 0 {
+		h.dropped++
+		return
+	}
+
+	if h.count < len(h.lines) {
+		h.lines[(h.start+h.count)%len(h.lines)] = line
+		h.count++
+		return
+	}
+
+	// full, overwrite the oldest line
+	h.lines[h.start] = line
+	h.start = (h.start + 1) % len(h.lines)
+	h.dropped++
+}
+
+// Lines returns the kept lines at level or above, oldest first
+func (h *logHistory) Lines(level Level) []logLine {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var lines []logLine
+	for i := 0; i < h.count; i++ {
+		line := h.lines[(h.start+i)%len(h.lines)]
+		if line.Level >= level {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// Dropped is how many lines no longer fit in the ring
+func (h *logHistory) Dropped() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// takeChanged reports whether lines were added since the last call,
+// the output view polls it so a burst of lines is one redraw
+func (h *logHistory) takeChanged() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	changed := h.changed
+	h.changed = false
+	return changed
+}
+
+// Clear forgets every line, including the ones in the history file
+func (h *logHistory) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.start, h.count, h.dropped = 0, 0, 0
+	h.changed = true
+	if h.file != nil {
+		h.w.Reset(h.file)
+		if err := h.file.Truncate(0); err == nil {
+			h.file.Seek(0, io.SeekStart)
+		}
+	}
+}
+
+// Save writes the whole log since the last Clear to path
+func (h *logHistory) Save(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return ioError("create", path, err)
+	}
+	defer out.Close()
+
+	if h.file != nil {
+		if err := h.w.Flush(); err != nil {
+			return ioError("write", h.file.Name(), err)
+		}
+		if _, err := h.file.Seek(0, io.SeekStart); err != nil {
+			return ioError("read", h.file.Name(), err)
+		}
+		_, err = io.Copy(out, h.file)
+		h.file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return ioError("write", path, err)
+		}
+	} else {
+		// without the file only the kept lines can be saved
+		for i := 0; i < h.count; i++ {
+			if _, err := fmt.Fprintln(out, h.lines[(h.start+i)%len(h.lines)].Text); err != nil {
+				return ioError("write", path, err)
+			}
+		}
+	}
+
+	return ioError("write", path, out.Close())
+}
+
+// Close removes the history file
+func (h *logHistory) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file != nil {
+		h.file.Close()
+		os.Remove(h.file.Name())
+		h.file = nil
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	logger := NewLogger()
+	var records []Record
+	setLevel := logger.AddSink(LevelInfo, SinkFunc(func(r Record) {
+		records = append(records, r)
+	}))
+
+	logger.Debugf("hidden %v", 1)
+	logger.Infof("shown %v", 2)
+	logger.Warn("careful")
+	if len(records) != 2 || records[0].Message != "shown 2" || records[1].Level != LevelWarn {
+		t.Fatalf("got %+v, want the info and warn records", records)
+	}
+
+	setLevel(LevelError)
+	logger.Warn("hidden")
+	logger.Error("failed")
+	if len(records) != 3 || records[2].Message != "failed" {
+		t.Errorf("after raising the level got %+v", records)
+	}
+	if logger.Enabled(LevelWarn) {
+		t.Error("warn should not be enabled at error level")
+	}
+
+	var nilLogger *Logger
+	nilLogger.With(trackField(1)).Errorf("dropped") // must not panic
+}
+
+func TestLoggerFields(t *testing.T) {
+	logger := NewLogger()
+	var out bytes.Buffer
+	logger.AddSink(LevelDebug, newConsoleSink(&out, &out))
+
+	groupLog := logger.With(groupField("Melody"))
+	groupLog.Info("adding track", trackField(3), channelField(10))
+	groupLog.Warn("odd name", Field{"name", "two words"})
+	logger.Info("no fields")
+
+	want := "adding track group=Melody track=3 channel=10\n" +
+		"warn: odd name group=Melody name=\"two words\"\n" +
+		"no fields\n"
+	if out.String() != want {
+		t.Errorf("got\n%v\nwant\n%v", out.String(), want)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for i, name := range logLevels {
+		level, err := parseLevel(name)
+		if err != nil || level != Level(i) || level.String() != name {
+			t.Errorf("parseLevel(%v) = %v, %v", name, level, err)
+		}
+	}
+	if _, err := parseLevel("loud"); err == nil {
+		t.Error("unknown level should be an error")
+	}
+}
+
+func TestLogHistory(t *testing.T) {
+	h := newLogHistory(3)
+	defer h.Close()
+
+	logger := NewLogger()
+	logger.AddSink(LevelDebug, h)
+	for i := 1; i <= 5; i++ {
+		logger.Infof("line %v", i)
+	}
+	logger.Warnf("two\nlines")
+
+	var got []string
+	for _, line := range h.Lines(LevelDebug) {
+		got = append(got, line.Text)
+	}
+	if want := []string{"line 5", "warn: two", "lines"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %q, want %q", got, want)
+	}
+	if h.Dropped() != 4 {
+		t.Errorf("dropped %v lines, want 4", h.Dropped())
+	}
+	if lines := h.Lines(LevelWarn); len(lines) != 2 {
+		t.Errorf("got %v warn lines, want 2", len(lines))
+	}
+	if !h.takeChanged() || h.takeChanged() {
+		t.Error("takeChanged should report the new lines once")
+	}
+
+	// saving keeps the lines the ring dropped
+	path := filepath.Join(t.TempDir(), "out.log")
+	if err := h.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if n := strings.Count(string(data), "\n"); n != 7 || !strings.Contains(string(data), "INFO  line 1\n") {
+		t.Errorf("saved log has %v lines:\n%s", n, data)
+	}
+
+	h.Clear()
+	logger.Infof("after clear")
+	if err := h.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Count(string(data), "\n") != 1 || len(h.Lines(LevelDebug)) != 1 || h.Dropped() != 0 {
+		t.Errorf("clear kept old lines:\n%s", data)
+	}
+}
@@ -1,29 +1,21 @@
 package main
 
 import (
-	"fmt"
+	"os"
 )
 
 // hi there
-// at points you will see both logf and a logger function
-// logger will log to the Output window in the GUI
-// logf will log to stdout
-// this is so that logf will be sort of like a debug log
-// and logger will be like a normal log for the user
+// everything is logged through a Logger (see log.go)
+// debug lines are for us, info and up are for the user
+// the gui shows them in the Output box, the cli prints them
 // :+1:
 
 func main() {
-	createGUI()
-}
-
-func handleErr(err error) {
-	if err != nil {
-		panic(err)
+	// a known command as the first argument runs the CLI instead of the GUI
+	// anything else (e.g. arguments added by the OS) still opens the GUI
+	if len(os.Args) > 1 && (findCLICommand(os.Args[1]) != nil || os.Args[1] == "help") {
+		os.Exit(runCLI(os.Args[1:]))
 	}
-}
 
-func logf(format string, a ...any) {
-	// we use println instead of fmt.Print because
-	// android doesn't pipe stdout/stderr to logcat
-	println(fmt.Sprintf(format, a...))
+	createGUI()
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+type MergeOptions struct {
+	PPQ int // resolution of the merged file, 0 uses the first file's
+
+	// which file's first (conductor) track is kept, starting at 0
+	// -1 merges the conductor tracks of every file into one
+	Conductor int
+
+	RunningStatus bool // leave out repeated status bytes in the tracks that are rewritten
+}
+
+// meta events that belong in the conductor track
+// tempo, smpte offset, time signature and key signature
+func isTempoMapEvent(ev midiEvent) bool {
+	return ev.status == 0xff && (ev.meta == 0x51 || ev.meta == 0x54 || ev.meta == 0x58 || ev.meta == 0x59)
+}
+
+func hasChannelEvents(track []byte) (bool, error) {
+	channels, err := trackChannels(track)
+	if err != nil {
+		return false, err
+	}
+
+	for _, used := range channels {
+		if used {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// checkDivision makes sure the file uses ticks per quarter note
+func checkDivision(path string, header midiHeader) error {
+	if header.division&0x8000 != 0 {
+		return fmt.Errorf("%v: SMPTE time division is not supported", path)
+	}
+	if header.division == 0 {
+		return fmt.Errorf("%v: time division is 0", path)
+	}
+
+	return nil
+}
+
+func readMergeInputs(inputPaths []string) ([]*midiFile, error) {
+	var files []*midiFile
+	for _, path := range inputPaths {
+		file, err := readMIDIFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		if file.header.format != 1 {
+			return nil, fmt.Errorf("%v: %w", path, &FormatError{Format: file.header.format})
+		}
+		if err := checkDivision(path, file.header); err != nil {
+			return nil, err
+		}
+		if len(file.tracks) == 0 {
+			return nil, fmt.Errorf("%v: file has no tracks", path)
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// mergeConductors combines the first track of every file into one track
+// only the first file's track name is kept
+func mergeConductors(files []*midiFile, ppq int, runningStatus bool) ([]byte, error) {
+	var events []timedEvent
+	for i, file := range files {
+		decoded, err := decodeTrack(file.tracks[0])
+		if err != nil {
+			return nil, fmt.Errorf("file %v conductor: %w", i+1, err)
+		}
+		rescaleEvents(decoded, file.header.division, ppq)
+
+		for _, ev := range decoded {
+			if i > 0 && ev.status == 0xff && ev.meta == 0x03 {
+				continue
+			}
+			events = append(events, ev)
+		}
+	}
+
+	sortEvents(events)
+	return encodeTrack(events, runningStatus), nil
+}
+
+// stripTempoMap removes the conductor events from a first track that also has notes,
+// so it can be kept as a normal track
+func stripTempoMap(track []byte, runningStatus bool) ([]byte, error) {
+	events, err := decodeTrack(track)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []timedEvent
+	for _, ev := range events {
+		if !isTempoMapEvent(ev.midiEvent) {
+			kept = append(kept, ev)
+		}
+	}
+
+	return encodeTrack(kept, runningStatus), nil
+}
+
+func mergeFiles(files []*midiFile, opts MergeOptions, logger *Logger) (*midiFile, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files to merge")
+	}
+	if opts.Conductor < -1 || opts.Conductor >= len(files) {
+		return nil, fmt.Errorf("conductor must be a file between 1 and %v", len(files))
+	}
+
+	ppq := opts.PPQ
+	if ppq == 0 {
+		ppq = files[0].header.division
+	} else if err := validatePPQ(ppq); err != nil {
+		return nil, fmt.Errorf("%w (or 0 for the first file's)", err)
+	}
+
+	merged := &midiFile{header: midiHeader{format: 1, division: ppq}}
+
+	// conductor first
+	if opts.Conductor == -1 {
+		logger.Infof("merging the conductor tracks of %v files", len(files))
+		conductor, err := mergeConductors(files, ppq, opts.RunningStatus)
+		if err != nil {
+			return nil, err
+		}
+		merged.tracks = append(merged.tracks, conductor)
+	} else {
+		logger.Infof("using the conductor track of file %v", opts.Conductor+1)
+		file := files[opts.Conductor]
+		conductor, err := rescaleTrack(file.tracks[0], file.header.division, ppq, opts.RunningStatus)
+		if err != nil {
+			return nil, fmt.Errorf("file %v conductor: %w", opts.Conductor+1, err)
+		}
+		merged.tracks = append(merged.tracks, conductor)
+	}
+
+	for i, file := range files {
+		from := file.header.division
+		if from != ppq {
+			logger.Infof("file %v: rescaling %v tracks from %v to %v ppq", i+1, len(file.tracks), from, ppq)
+		}
+
+		// the other first tracks are kept only if they have notes or other channel events
+		if opts.Conductor != -1 && opts.Conductor != i {
+			keep, err := hasChannelEvents(file.tracks[0])
+			if err != nil {
+				return nil, fmt.Errorf("file %v track 0: %w", i+1, err)
+			}
+			if keep {
+				track, err := stripTempoMap(file.tracks[0], opts.RunningStatus)
+				if err == nil {
+					track, err = rescaleTrack(track, from, ppq, opts.RunningStatus)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("file %v track 0: %w", i+1, err)
+				}
+				logger.Infof("file %v: keeping its first track as it has channel events", i+1)
+				merged.tracks = append(merged.tracks, track)
+			}
+		}
+
+		if len(merged.tracks)+len(file.tracks)-1 > maxTracks {
+			return nil, &TrackLimitError{Count: len(merged.tracks) + len(file.tracks) - 1}
+		}
+
+		for j, track := range file.tracks[1:] {
+			rescaled, err := rescaleTrack(track, from, ppq, opts.RunningStatus)
+			if err != nil {
+				return nil, fmt.Errorf("file %v track %v: %w", i+1, j+1, err)
+			}
+			merged.tracks = append(merged.tracks, rescaled)
+		}
+
+		logger.Infof("file %v: added %v tracks", i+1, len(file.tracks)-1)
+	}
+
+	return merged, nil
+}
+
+// MergeMIDIFiles combines the tracks of several format 1 files into one file
+func MergeMIDIFiles(inputPaths []string, outputPath string, opts MergeOptions, logger *Logger) error {
+	files, err := readMergeInputs(inputPaths)
+	if err != nil {
+		return err
+	}
+
+	merged, err := mergeFiles(files, opts, logger)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("writing %v tracks at %v ppq to %v", len(merged.tracks), merged.header.division, outputPath)
+	return merged.save(outputPath)
+}
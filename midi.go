@@ -1,120 +1,87 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"io"
 	"os"
 )
 
-func ReadMIDITracks(path string, logger func(format string, a ...any)) (int, error) {
-	logf("reading midi path: %v", path)
-	logger("reading midi path: " + path)
+func ReadMIDITracks(path string, logger *Logger) (int, error) {
+	logger.Infof("reading midi path: %v", path)
 
 	// open midi file
 	midiFile, err := os.Open(path)
 	if err != nil {
-		return -1, err
+		return -1, ioError("open", path, err)
 	}
 	defer midiFile.Close()
 
 	// parse header track
-
-	// parse type
-	// ensure that type is of MThd
-	headerType := make([]byte, 4)
-	_, err = midiFile.Read(headerType)
-	if err != nil {
-		return -1, err
-	}
-
-	if string(headerType) != "MThd" {
-		logf("invalid header track | header type: %v", string(headerType))
-		return -1, errors.New("MIDI file does not contain header track")
-	}
-
-	// parse header size
-	// ensure that header size is 6
-	headerSize := make([]byte, 4)
-	_, err = midiFile.Read(headerSize)
+	header, err := readHeader(midiFile)
 	if err != nil {
 		return -1, err
 	}
 
-	if headerSize[0] != 0 || headerSize[1] != 0 || headerSize[2] != 0 || headerSize[3] != 6 {
-		logf("invalid header size (>6) | header type: %v", string(headerType))
-		return -1, errors.New("MIDI header size is not 6")
-	}
-
-	// parse format
 	// ensure that format is 1
-	format := make([]byte, 2)
-	_, err = midiFile.Read(format)
-	if err != nil {
-		return -1, err
+	if header.format != 1 {
+		logger.Debugf("invalid midi format | format: %v", header.format)
+		return -1, &FormatError{Format: header.format}
 	}
 
-	if format[0] != 0 || format[1] != 1 {
-		logf("invalid midi format | header type: %v", string(headerType))
-		return -1, errors.New("MIDI format is not 1")
-	}
-
-	// parse track count
-	// write to trackCountInt as an integer
-	trackCount := make([]byte, 2)
-	_, err = midiFile.Read(trackCount)
-	if err != nil {
-		return -1, err
-	}
-
-	trackCountInt := int(trackCount[0])<<8 | int(trackCount[1])
+	trackCountInt := header.trackCount
 
 	// we don't need to check the time division as it is not used
 
-	logger("track count: %v", trackCountInt)
+	logger.Infof("track count: %v", trackCountInt)
 
 	// return track count
-	logf("finished reading midi path: %v", path)
-	logf("header: %v (%v bytes) with %v tracks", string(headerType), headerSize, trackCountInt)
+	logger.Debugf("finished reading midi path: %v", path)
+	logger.Debugf("header: format %v, division %v with %v tracks", header.format, header.division, trackCountInt)
 	return trackCountInt, nil
 }
 
-func writePremadeMidi(inputPath string, trackCount int, trackData []byte) error {
-	// only modify the track count in the header track
+func writePremadeMidi(ctx context.Context, info MIDIInfo) error {
+	if (info.insert.Mode != "" && info.insert.Mode != "end") || info.conductor.changesConductor() {
+		return insertPremadeMidi(ctx, info)
+	}
+
+	// appending only needs the track count in the header track modified,
+	// the rest of the file is copied as it is
 
 	// open midi file
-	midiFile, err := os.OpenFile(inputPath, os.O_RDWR, 0644)
+	midiFile, err := os.Open(info.midiPath)
 	if err != nil {
-		return err
+		return ioError("open", info.midiPath, err)
 	}
 	defer midiFile.Close()
 
-	// convert track count to bytes
-	trackCountBytes := NumberToBytes(trackCount, 2)
-
-	// edit track count to be the new track count
-	// write to trackCountInt as an integer
-	midiFile.Seek(10, 0) // Seek to track count
-	_, err = midiFile.Write(trackCountBytes)
+	stat, err := midiFile.Stat()
 	if err != nil {
-		return err
+		return ioError("read", info.midiPath, err)
 	}
-
-	// write track data
-	midiFile.Seek(0, 2) // Seek to end of file
-	_, err = midiFile.Write(trackData)
-	if err != nil {
-		return err
+	header := make([]byte, 14)
+	if _, err := io.ReadFull(midiFile, header); err != nil {
+		return headerReadError(err)
 	}
 
-	return nil
-}
+	// edit track count to be the new track count
+	copy(header[10:12], NumberToBytes(info.trackCount, 2))
 
-func writeNewMidi(info MIDIInfo) error {
-	// create new midi file
-	midiFile, err := os.Create(info.midiPath)
-	if err != nil {
+	total := stat.Size() + int64(len(info.tracks))
+	return replaceFile(ctx, info.midiPath, info.writeProgress(total), func(w io.Writer) error {
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, midiFile); err != nil {
+			return err
+		}
+		// write track data
+		_, err := w.Write(info.tracks)
 		return err
-	}
+	})
+}
 
+func writeNewMidi(ctx context.Context, info MIDIInfo) error {
 	// write header track
 	headerType := []byte("MThd")
 	headerSize := []byte{0, 0, 0, 6}
@@ -135,7 +102,7 @@ func writeNewMidi(info MIDIInfo) error {
 	// write tempo change
 	tempoChange := []byte{0x00, 0xFF, 0x51, 0x03}  // delta time, meta event, set tempo, 3 bytes
 	tempo := NumberToBytes(60_000_000/info.bpm, 3) // 60_000_000 is the number of microseconds per minute
-	println("tempo: ", tempo, " (60_000_000/", info.bpm, ")")
+	info.logger.Debugf("tempo: % x (60_000_000/%v)", tempo, info.bpm)
 	tempoChange = append(tempoChange, tempo...)
 
 	// write end of track
@@ -150,49 +117,41 @@ func writeNewMidi(info MIDIInfo) error {
 	conductor = append(conductor, conductorData...)
 
 	// write file
-	_, err = midiFile.Write(header)
-	if err != nil {
-		return err
-	}
-	_, err = midiFile.Write(conductor)
-	if err != nil {
-		return err
-	}
-	_, err = midiFile.Write(info.tracks)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	total := int64(len(header) + len(conductor) + len(info.tracks))
+	return replaceFile(ctx, info.midiPath, info.writeProgress(total), func(w io.Writer) error {
+		for _, data := range [][]byte{header, conductor, info.tracks} {
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func WriteMIDI(info MIDIInfo) {
+// WriteMIDI writes a new file, or adds the tracks to the file if it already exists
+// ctx cancels the write, the file is then left as it was
+func WriteMIDI(ctx context.Context, info MIDIInfo) error {
 	// get the data from input midi file if provided
-	logf("writing to midi path: %v", info.midiPath)
-	info.logger("writing to midi path: " + info.midiPath)
+	info.logger.Infof("writing to midi path: %v", info.midiPath)
 
 	if _, err := os.Stat(info.midiPath); os.IsNotExist(err) {
-		logf("midi file does not exist, creating new midi file")
-		err := writeNewMidi(info)
-		if err != nil {
-			logf("could not write to midi file, error: %v", err.Error())
-			info.logger("error writing to new midi file: " + err.Error())
+		info.logger.Debugf("midi file does not exist, creating new midi file")
+		if err := writeNewMidi(ctx, info); err != nil {
+			info.logger.Debugf("could not write to midi file, error: %v", err.Error())
+			return err
 		}
-		logf("wrote new midi to path: %v", info.midiPath)
-		info.logger("wrote to new midi file: " + info.midiPath)
+		info.logger.Infof("wrote to new midi file: %v", info.midiPath)
 	} else {
-		// only update the trackcount in the header track
-		logf("midi file exists, appending to midi file")
-		err := writePremadeMidi(info.midiPath, info.trackCount, info.tracks)
+		info.logger.Debugf("midi file exists, appending to midi file")
+		err := writePremadeMidi(ctx, info)
 		if err != nil {
-			logf("could not save midi file, error: %v", err.Error())
-			info.logger("error writing to premade midi file: " + err.Error())
+			info.logger.Debugf("could not save midi file, error: %v", err.Error())
+			return err
 		}
-		logf("saved premade midi to path: %v", info.midiPath)
-		info.logger("wrote to premade midi file: " + info.midiPath)
+		info.logger.Infof("wrote to premade midi file: %v", info.midiPath)
 	}
 
-	info.callback()
+	return nil
 }
 
 type MIDIInfo struct {
@@ -201,7 +160,18 @@ type MIDIInfo struct {
 	midiPath   string
 	ppq        int
 	bpm        int
-	allowDrums bool
-	logger     func(format string, a ...any)
-	callback   func()
+	insert     InsertPosition   // only used when the file already exists
+	conductor  ConductorOptions // only used when the file already exists
+	logger     *Logger
+	progress   func(written int64, total int64) // may be nil
+}
+
+// writeProgress turns the bytes written into progress calls for a write of total bytes
+func (info MIDIInfo) writeProgress(total int64) func(written int64) {
+	if info.progress == nil {
+		return nil
+	}
+	return func(written int64) {
+		info.progress(written, total)
+	}
 }
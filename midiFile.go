@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// the track count in the header is 2 bytes
+const maxTracks = 65535
+
+type midiHeader struct {
+	format     int
+	trackCount int // track count written in the header
+	division   int // ticks per quarter note (ppq)
+}
+
+// midiFile is a whole MIDI file in memory
+// tracks holds the data of each MTrk chunk, without the MTrk type and size
+type midiFile struct {
+	header midiHeader
+	tracks [][]byte
+}
+
+// headerReadError turns a file that ends inside the header into a HeaderError
+func headerReadError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &HeaderError{Reason: "file is too short"}
+	}
+	return err
+}
+
+// readHeader reads and checks the MThd chunk
+func readHeader(r io.Reader) (midiHeader, error) {
+	var header midiHeader
+
+	// parse type
+	// ensure that type is of MThd
+	headerType := make([]byte, 4)
+	if _, err := io.ReadFull(r, headerType); err != nil {
+		return header, headerReadError(err)
+	}
+
+	if string(headerType) != "MThd" {
+		appLog.Debugf("invalid header track | header type: %v", string(headerType))
+		return header, &HeaderError{Reason: "MIDI file does not contain header track"}
+	}
+
+	// parse header size
+	// ensure that header size is 6
+	headerSize := make([]byte, 4)
+	if _, err := io.ReadFull(r, headerSize); err != nil {
+		return header, headerReadError(err)
+	}
+
+	if binary.BigEndian.Uint32(headerSize) != 6 {
+		appLog.Debugf("invalid header size (>6) | header type: %v", string(headerType))
+		return header, &HeaderError{Reason: "MIDI header size is not 6"}
+	}
+
+	// format, track count and time division, 2 bytes each
+	fields := make([]byte, 6)
+	if _, err := io.ReadFull(r, fields); err != nil {
+		return header, headerReadError(err)
+	}
+
+	header.format = int(binary.BigEndian.Uint16(fields[0:2]))
+	header.trackCount = int(binary.BigEndian.Uint16(fields[2:4]))
+	header.division = int(binary.BigEndian.Uint16(fields[4:6]))
+
+	return header, nil
+}
+
+func (h midiHeader) bytes() []byte {
+	header := []byte("MThd")
+	header = append(header, 0, 0, 0, 6)
+	header = append(header, NumberToBytes(h.format, 2)...)
+	header = append(header, NumberToBytes(h.trackCount, 2)...)
+	header = append(header, NumberToBytes(h.division, 2)...)
+
+	return header
+}
+
+// readChunk reads the next chunk, returning its type and data
+func readChunk(r io.Reader) (string, []byte, error) {
+	prefix := make([]byte, 8)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return "", nil, err
+	}
+
+	// the size is not trusted for the allocation, a broken header could ask for 4GB
+	size := int64(binary.BigEndian.Uint32(prefix[4:8]))
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(data)) != size {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+
+	return string(prefix[0:4]), data, nil
+}
+
+func parseMIDI(r io.Reader) (*midiFile, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &midiFile{header: header}
+	for {
+		chunkType, data, err := readChunk(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// unknown chunks are allowed by the spec, they are dropped
+		if chunkType != "MTrk" {
+			appLog.Debugf("skipping unknown chunk %v (%v bytes)", chunkType, len(data))
+			continue
+		}
+
+		file.tracks = append(file.tracks, data)
+	}
+
+	if len(file.tracks) != header.trackCount {
+		appLog.Warnf("header says %v tracks but file has %v", header.trackCount, len(file.tracks))
+	}
+
+	return file, nil
+}
+
+func readMIDIFile(path string) (*midiFile, error) {
+	appLog.Debugf("reading midi file: %v", path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ioError("open", path, err)
+	}
+	defer f.Close()
+
+	return parseMIDI(bufio.NewReader(f))
+}
+
+// splitTrackChunks splits the output of createTracks back into separate tracks
+func splitTrackChunks(data []byte) ([][]byte, error) {
+	var tracks [][]byte
+
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		chunkType, chunk, err := readChunk(r)
+		if err != nil {
+			return nil, err
+		}
+		if chunkType != "MTrk" {
+			return nil, fmt.Errorf("expected MTrk chunk, got %v", chunkType)
+		}
+		tracks = append(tracks, chunk)
+	}
+
+	return tracks, nil
+}
+
+func (m *midiFile) write(w io.Writer) error {
+	// the header always matches the tracks we write
+	if len(m.tracks) > maxTracks {
+		return &TrackLimitError{Count: len(m.tracks)}
+	}
+	m.header.trackCount = len(m.tracks)
+
+	if _, err := w.Write(m.header.bytes()); err != nil {
+		return err
+	}
+
+	for _, track := range m.tracks {
+		if _, err := w.Write([]byte("MTrk")); err != nil {
+			return err
+		}
+		if _, err := w.Write(NumberToBytes(len(track), 4)); err != nil {
+			return err
+		}
+		if _, err := w.Write(track); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// size is how many bytes write writes
+func (m *midiFile) size() int64 {
+	size := int64(len(m.header.bytes()))
+	for _, track := range m.tracks {
+		size += 8 + int64(len(track))
+	}
+	return size
+}
+
+// save writes the file to a temporary file next to path and then
+// renames it over path, so a failed write never leaves a broken file
+func (m *midiFile) save(path string) error {
+	return replaceFile(context.Background(), path, nil, m.write)
+}
+
+// progressWriter stops writing once ctx is done and reports the bytes written so far
+type progressWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	written  int64
+	progress func(written int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil {
+		p.progress(p.written)
+	}
+	return n, err
+}
+
+// replaceFile calls write with a temporary file next to path and renames it over
+// path once everything is written, so an error or a cancelled ctx leaves path as it was
+// progress (if not nil) is called with the bytes written so far
+func replaceFile(ctx context.Context, path string, progress func(written int64), write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return ioError("create", path, err)
+	}
+	defer os.Remove(tmp.Name()) // does nothing once renamed
+
+	// temporary files are only readable by us, keep the mode of the file being replaced
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp.Chmod(mode)
+
+	w := bufio.NewWriter(&progressWriter{ctx: ctx, w: tmp, progress: progress})
+	if err := write(w); err != nil {
+		tmp.Close()
+		var limitErr *TrackLimitError
+		if errors.As(err, &limitErr) || ctx.Err() != nil {
+			return err
+		}
+		return ioError("write", path, err)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		if ctx.Err() != nil {
+			return err
+		}
+		return ioError("write", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return ioError("write", path, err)
+	}
+
+	// last chance to cancel, after this the file is replaced
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return ioError("replace", path, os.Rename(tmp.Name(), path))
+}
+
+// channelEventCounts counts the channel events of each channel (index 1-16) in the track
+func channelEventCounts(track []byte) ([17]int, error) {
+	var counts [17]int
+
+	er := newEventReader(bytes.NewReader(track))
+	for {
+		ev, err := er.next()
+		if errors.Is(err, io.EOF) {
+			return counts, nil
+		}
+		if err != nil {
+			return counts, err
+		}
+
+		if ch := ev.channel(); ch > 0 {
+			counts[ch]++
+		}
+	}
+}
+
+// trackChannels returns which channels (index 1-16) have channel events in the track
+func trackChannels(track []byte) ([17]bool, error) {
+	var channels [17]bool
+
+	counts, err := channelEventCounts(track)
+	for ch, n := range counts {
+		channels[ch] = n > 0
+	}
+
+	return channels, err
+}
+
+// trackName returns the text of the first track name event, or "" if the track has none
+func trackName(track []byte) (string, error) {
+	er := newEventReader(bytes.NewReader(track))
+	for {
+		ev, err := er.next()
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if ev.status == 0xff && ev.meta == 0x03 {
+			return string(ev.data), nil
+		}
+	}
+}
+
+// limitedByteReader reads at most n bytes, like io.LimitReader but for io.ByteReader
+type limitedByteReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (l *limitedByteReader) ReadByte() (byte, error) {
+	if l.n <= 0 {
+		return 0, io.EOF
+	}
+	l.n--
+
+	return l.r.ReadByte()
+}
+
+// errStopStreaming can be returned by the fn of streamTracks to stop reading without an error
+var errStopStreaming = errors.New("stop streaming")
+
+// streamTracks calls fn with a reader over each track of the file without loading the file
+// into memory, so it can be used on very large files
+func streamTracks(path string, fn func(header midiHeader, index int, track io.ByteReader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return ioError("open", path, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 1<<20)
+	header, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+
+	prefix := make([]byte, 8)
+	for index := 0; ; {
+		if _, err := io.ReadFull(r, prefix); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(prefix[4:8]))
+		if string(prefix[0:4]) != "MTrk" {
+			if _, err := r.Discard(int(size)); err != nil {
+				return unexpectedEOF(err)
+			}
+			continue
+		}
+
+		track := &limitedByteReader{r: r, n: size}
+		if err := fn(header, index, track); errors.Is(err, errStopStreaming) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("track %v: %w", index, err)
+		}
+
+		// skip whatever fn did not read
+		if _, err := r.Discard(int(track.n)); err != nil {
+			return unexpectedEOF(err)
+		}
+		index++
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// seeds the fuzz targets with every golden file
+func addGoldenSeeds(f *testing.F) {
+	paths, _ := filepath.Glob(filepath.Join("testdata", "golden", "*.mid"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			f.Add(data)
+		}
+	}
+}
+
+// any file that parses writes back to a file that parses to the same tracks
+func FuzzParseMIDI(f *testing.F) {
+	addGoldenSeeds(f)
+	f.Add([]byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1, 0, 0, 0, 96})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := parseMIDI(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if len(file.tracks) > maxTracks {
+			return
+		}
+
+		var out bytes.Buffer
+		if err := file.write(&out); err != nil {
+			t.Fatal(err)
+		}
+		again, err := parseMIDI(&out)
+		if err != nil {
+			t.Fatalf("written file does not parse: %v", err)
+		}
+		if !reflect.DeepEqual(again.tracks, file.tracks) {
+			t.Error("tracks changed after writing")
+		}
+	})
+}
+
+// the event reader never panics, and tracks it can read survive a decode and encode
+func FuzzDecodeTrack(f *testing.F) {
+	addGoldenSeeds(f)
+	f.Add([]byte{0x00, 0x90, 60, 100, 0x10, 60, 0, 0x00, 0xff, 0x2f, 0x00})
+	f.Add([]byte{0x00, 0xf0, 0x03, 0x7e, 0x7f, 0xf7, 0x00, 0xc0, 0x05})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		events, err := decodeTrack(data)
+		if err != nil {
+			return
+		}
+		sortEvents(events)
+
+		// dropping an end of track in the middle can leave a gap too long for one delta time
+		var last uint64
+		for _, ev := range events {
+			if ev.tick-last > 0x0fffffff {
+				return
+			}
+			if !ev.isEndOfTrack() {
+				last = ev.tick
+			}
+		}
+
+		for _, runningStatus := range []bool{false, true} {
+			encoded := encodeTrack(events, runningStatus)
+
+			decoded, err := decodeTrack(encoded)
+			if err != nil {
+				t.Fatalf("running status %v: encoded track does not decode: %v", runningStatus, err)
+			}
+
+			// encodeTrack leaves a single end of track at the end
+			var want []timedEvent
+			var end uint64
+			for _, ev := range events {
+				if ev.tick > end {
+					end = ev.tick
+				}
+				if !ev.isEndOfTrack() {
+					want = append(want, ev)
+				}
+			}
+			want = append(want, timedEvent{tick: end, midiEvent: midiEvent{status: 0xff, meta: 0x2f, data: []byte{}}})
+
+			if len(decoded) != len(want) {
+				t.Fatalf("running status %v: got %v events, want %v", runningStatus, len(decoded), len(want))
+			}
+			for i := range want {
+				got, w := decoded[i], want[i]
+				if got.tick != w.tick || got.status != w.status || got.meta != w.meta || !bytes.Equal(got.data, w.data) {
+					t.Fatalf("running status %v: event %v is %+v, want %+v", runningStatus, i, got, w)
+				}
+			}
+		}
+	})
+}
+
+// the streaming reader sees the same tracks as the reader that loads the whole file
+func FuzzStreamTracks(f *testing.F) {
+	addGoldenSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := parseMIDI(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		path := filepath.Join(t.TempDir(), "fuzz.mid")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var streamed [][]byte
+		err = streamTracks(path, func(header midiHeader, index int, track io.ByteReader) error {
+			var b []byte
+			for {
+				c, err := track.ReadByte()
+				if err != nil {
+					break
+				}
+				b = append(b, c)
+			}
+			streamed = append(streamed, b)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("parseMIDI read the file but streamTracks did not: %v", err)
+		}
+		if len(streamed) != len(file.tracks) {
+			t.Fatalf("streamed %v tracks, parsed %v", len(streamed), len(file.tracks))
+		}
+		for i := range streamed {
+			if !bytes.Equal(streamed[i], file.tracks[i]) {
+				t.Fatalf("track %v differs", i)
+			}
+		}
+	})
+}
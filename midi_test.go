@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// a nil logger drops every line
+var nopLogger *Logger
+
+type goldenCase struct {
+	name          string
+	groups        []TrackGroup
+	order         TrackOrder
+	ppq           int
+	bpm           int
+	runningStatus bool
+}
+
+func goldenCases() []goldenCase {
+	drums := []TrackGroup{
+		{Name: "Melody", Count: 3, Channels: "1-3", Program: 1},
+		{Name: "GM", Count: 4, Channels: "10", Drums: true, DrumMode: "gm", DrumNames: true},
+		{Name: "GS", Count: 2, Channels: "11-12", Program: 25, Drums: true, DrumMode: "gs", NameFormat: "{group} {n} ch{ch}"},
+		{Name: "XG", Count: 2, Channels: "13", Drums: true, DrumMode: "xg", DrumNames: true},
+	}
+
+	return []goldenCase{
+		{name: "default", groups: defaultTrackGroups(), order: TrackOrder{Mode: "grouped"}, ppq: 960, bpm: 138},
+		{name: "default_interleaved_96", groups: defaultTrackGroups(), order: TrackOrder{Mode: "interleaved"}, ppq: 96, bpm: 120},
+		{name: "default_channel_480", groups: defaultTrackGroups(), order: TrackOrder{Mode: "channel"}, ppq: 480, bpm: 200},
+		{name: "default_running_status", groups: defaultTrackGroups(), order: TrackOrder{Mode: "grouped"}, ppq: 960, bpm: 138, runningStatus: true},
+		{name: "skip_drum_channel", groups: []TrackGroup{{Name: "Melody", Count: 20, Channels: "8-12", NameFormat: "{group} {n}"}}, order: TrackOrder{Mode: "grouped"}, ppq: 3840, bpm: 60},
+		{name: "allow_drum_channel", groups: []TrackGroup{{Name: "Melody", Count: 6, Channels: "9-11", AllowDrums: true}}, order: TrackOrder{Mode: "grouped"}, ppq: 960, bpm: 138},
+		{name: "drums", groups: drums, order: TrackOrder{Mode: "grouped"}, ppq: 960, bpm: 138},
+		{name: "custom_order_port", groups: []TrackGroup{
+			{Name: "Melody", Count: 4, Channels: "1-4", NameFormat: "M{n}"},
+			{Name: "Art", Count: 4, Channels: "1-2", Port: 1, NameFormat: "A{n} ch{ch}"},
+		}, order: TrackOrder{Mode: "custom", Pattern: "Melody,Art,Art"}, ppq: 192, bpm: 174},
+	}
+}
+
+// compareGolden compares data with testdata/golden/name.mid, or rewrites the file with -update
+func compareGolden(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name+".mid")
+	if *update {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%v differs from the golden file (%v bytes, want %v)\ngot  % x\nwant % x", name, len(data), len(want), data, want)
+	}
+}
+
+// createGoldenFile writes a new file the way the gui does
+func createGoldenFile(t *testing.T, c goldenCase, path string) {
+	t.Helper()
+
+	tracks := groupTracks(t, c.groups, c.order, c.runningStatus)
+	err := writeNewMidi(context.Background(), MIDIInfo{
+		tracks:     tracks,
+		trackCount: totalTrackCount(c.groups),
+		midiPath:   path,
+		ppq:        c.ppq,
+		bpm:        c.bpm,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGoldenNewFiles(t *testing.T) {
+	for _, c := range goldenCases() {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.mid")
+			createGoldenFile(t, c, path)
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, c.name, data)
+
+			count, err := ReadMIDITracks(path, nopLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := totalTrackCount(c.groups) + 1; count != want {
+				t.Errorf("ReadMIDITracks = %v, want %v", count, want)
+			}
+		})
+	}
+}
+
+func TestGoldenAppend(t *testing.T) {
+	inserts := map[string]InsertPosition{
+		"append_end":             {Mode: "end"},
+		"append_after_track_0":   {Mode: "after-track", Value: 0},
+		"append_after_channel_1": {Mode: "after-channel", Value: 1},
+	}
+
+	for name, insert := range inserts {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.mid")
+			base := goldenCases()[0]
+			createGoldenFile(t, base, path)
+
+			groups := []TrackGroup{{Name: "New", Count: 2, Channels: "5", NameFormat: "{group} {n}"}}
+			existing, err := ReadMIDITracks(path, nopLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			trackCount := existing + totalTrackCount(groups)
+
+			tracks := groupTracks(t, groups, TrackOrder{}, false)
+			err = writePremadeMidi(context.Background(), MIDIInfo{midiPath: path, trackCount: trackCount, tracks: tracks, insert: insert})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, name, data)
+
+			if count, err := ReadMIDITracks(path, nopLogger); err != nil || count != trackCount {
+				t.Errorf("ReadMIDITracks = %v, %v, want %v", count, err, trackCount)
+			}
+		})
+	}
+}
+
+// appending then reading keeps every existing track as it was
+func TestAppendKeepsTracks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.mid")
+	createGoldenFile(t, goldenCases()[6], path)
+
+	before, err := readMIDIFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added := groupTracks(t, defaultTrackGroups(), TrackOrder{}, false)
+	if err := writePremadeMidi(context.Background(), MIDIInfo{midiPath: path, trackCount: len(before.tracks) + 16, tracks: added, insert: InsertPosition{Mode: "end"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := readMIDIFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.header.trackCount != len(after.tracks) {
+		t.Errorf("header says %v tracks, file has %v", after.header.trackCount, len(after.tracks))
+	}
+
+	newTracks, err := splitTrackChunks(added)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([][]byte{}, before.tracks...), newTracks...)
+	if len(after.tracks) != len(want) {
+		t.Fatalf("got %v tracks, want %v", len(after.tracks), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(after.tracks[i], want[i]) {
+			t.Errorf("track %v changed", i)
+		}
+	}
+}
+
+func TestReadMIDITracksErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	format0 := filepath.Join(dir, "format0.mid")
+	os.WriteFile(format0, []byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96}, 0644)
+	_, err := ReadMIDITracks(format0, nopLogger)
+	var formatErr *FormatError
+	if !errors.As(err, &formatErr) || formatErr.Format != 0 {
+		t.Errorf("format 0 file gave %v, want a FormatError", err)
+	}
+
+	garbage := filepath.Join(dir, "garbage.mid")
+	os.WriteFile(garbage, []byte("RIFF not a midi file"), 0644)
+	_, err = ReadMIDITracks(garbage, nopLogger)
+	var headerErr *HeaderError
+	if !errors.As(err, &headerErr) {
+		t.Errorf("file without MThd gave %v, want a HeaderError", err)
+	}
+
+	short := filepath.Join(dir, "short.mid")
+	os.WriteFile(short, []byte("MTh"), 0644)
+	if _, err := ReadMIDITracks(short, nopLogger); !errors.As(err, &headerErr) {
+		t.Errorf("truncated header gave %v, want a HeaderError", err)
+	}
+
+	_, err = ReadMIDITracks(filepath.Join(dir, "missing.mid"), nopLogger)
+	var ioErr *IOError
+	if !errors.As(err, &ioErr) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file gave %v, want an IOError", err)
+	}
+}
+
+func TestCreateMIDIErrors(t *testing.T) {
+	dir := t.TempDir()
+	opts := func(path string, groups []TrackGroup) CreateOptions {
+		return CreateOptions{Path: path, Groups: groups, PPQ: 960, BPM: 120, Insert: InsertPosition{Mode: "end"}}
+	}
+
+	tests := []struct {
+		name string
+		opts CreateOptions
+		code int
+	}{
+		{"no tracks", opts(filepath.Join(dir, "a.mid"), []TrackGroup{{Name: "A", Channels: "1", NameFormat: "{n}"}}), 1},
+		{"bad channels", opts(filepath.Join(dir, "a.mid"), []TrackGroup{{Name: "A", Count: 1, Channels: "17", NameFormat: "{n}"}}), 1},
+		{"too many tracks", opts(filepath.Join(dir, "a.mid"), []TrackGroup{{Name: "A", Count: maxTracks, Channels: "1", NameFormat: "{n}"}}), exitTrackLimit},
+		{"missing folder", opts(filepath.Join(dir, "missing", "a.mid"), defaultTrackGroups()), exitIO},
+	}
+
+	for _, tt := range tests {
+		err := CreateMIDI(context.Background(), tt.opts, nopLogger)
+		if err == nil {
+			t.Errorf("%v: expected an error", tt.name)
+			continue
+		}
+		if code := exitCode(err); code != tt.code {
+			t.Errorf("%v: exit code %v for %v, want %v", tt.name, code, err, tt.code)
+		}
+	}
+
+	bpm := opts(filepath.Join(dir, "a.mid"), defaultTrackGroups())
+	bpm.BPM = 0
+	if err := CreateMIDI(context.Background(), bpm, nopLogger); err == nil {
+		t.Error("bpm 0 should be an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.mid")); !os.IsNotExist(err) {
+		t.Error("a failed create should not write the file")
+	}
+
+	garbage := filepath.Join(dir, "garbage.mid")
+	os.WriteFile(garbage, []byte("RIFF not a midi file"), 0644)
+	if err := CreateMIDI(context.Background(), opts(garbage, defaultTrackGroups()), nopLogger); exitCode(err) != exitInvalidFile {
+		t.Errorf("adding to a file that is not MIDI gave %v, want exit code %v", err, exitInvalidFile)
+	}
+}
+
+// a cancelled create leaves no file behind, or the existing file as it was
+func TestCreateMIDICancel(t *testing.T) {
+	dir := t.TempDir()
+	groups := []TrackGroup{{Name: "A", Count: 2000, Channels: "1-16", NameFormat: "{n}"}}
+
+	for _, existing := range []bool{false, true} {
+		path := filepath.Join(dir, fmt.Sprintf("existing_%v.mid", existing))
+		var before []byte
+		if existing {
+			createGoldenFile(t, goldenCases()[0], path)
+			before, _ = os.ReadFile(path)
+		}
+
+		// cancel once half of the file is written
+		ctx, cancel := context.WithCancel(context.Background())
+		opts := CreateOptions{Path: path, Groups: groups, PPQ: 960, BPM: 120, Insert: InsertPosition{Mode: "end"}}
+		opts.Progress = func(p CreateProgress) {
+			if p.TotalBytes > 0 && p.Written > p.TotalBytes/2 {
+				cancel()
+			}
+		}
+
+		err := CreateMIDI(ctx, opts, nopLogger)
+		cancel()
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("existing %v: got %v, want context.Canceled", existing, err)
+		}
+
+		after, err := os.ReadFile(path)
+		if existing && !bytes.Equal(after, before) {
+			t.Errorf("cancelling changed the existing file")
+		}
+		if !existing && !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("cancelling left a new file behind")
+		}
+	}
+
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmp) > 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+}
+
+func TestCreateMIDIProgress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.mid")
+	var last CreateProgress
+	opts := CreateOptions{Path: path, Groups: defaultTrackGroups(), PPQ: 960, BPM: 120, Insert: InsertPosition{Mode: "end"}}
+	opts.Progress = func(p CreateProgress) {
+		if p.Fraction() < last.Fraction() {
+			t.Errorf("progress went back from %v to %v", last, p)
+		}
+		last = p
+	}
+
+	if err := CreateMIDI(context.Background(), opts, nopLogger); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	if last.Tracks != 16 || last.Written != info.Size() || last.Fraction() != 1 {
+		t.Errorf("last progress is %+v (%v), file is %v bytes", last, last.Fraction(), info.Size())
+	}
+}
+
+// the plan is what create writes, and planning never changes the file
+func TestPlanMIDI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.mid")
+	groups := []TrackGroup{{Name: "A", Count: 5, Channels: "8-11", NameFormat: "{n}"}}
+	opts := CreateOptions{Path: path, Groups: groups, PPQ: 960, BPM: 120, Insert: InsertPosition{Mode: "end"}}
+
+	plan, err := PlanMIDI(opts, nopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var channels []int
+	for i, track := range plan.Tracks {
+		if track.Index != i+1 {
+			t.Errorf("track %v has index %v in a new file", i, track.Index)
+		}
+		channels = append(channels, track.Channel)
+	}
+	if want := []int{8, 9, 11, 8, 9}; !reflect.DeepEqual(channels, want) || !plan.NewFile {
+		t.Errorf("planned channels %v (new file %v), want %v", channels, plan.NewFile, want)
+	}
+	if want := []SkippedTrack{{"A", 3}}; !reflect.DeepEqual(plan.Skipped, want) {
+		t.Errorf("skipped %+v, want %+v", plan.Skipped, want)
+	}
+	if data, _ := json.Marshal(plan); !strings.Contains(string(data), `"insert":{"mode":"end","value":0}`) {
+		t.Errorf("plan json is %s", data)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("planning wrote the file")
+	}
+
+	if err := CreateMIDI(context.Background(), opts, nopLogger); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+	plan, err = PlanMIDI(opts, nopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.NewFile || plan.ExistingTracks != 6 || plan.Tracks[0].Index != 6 {
+		t.Errorf("plan for the existing file is %+v", plan)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("planning changed the existing file")
+	}
+}
+
+// an edited plan is written as edited, and a plan for a file that changed since is refused
+func TestWritePlanEdited(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.mid")
+	groups := []TrackGroup{{Name: "A", Count: 3, Channels: "1-3", NameFormat: "{group}{n}"}}
+	opts := CreateOptions{Path: path, Groups: groups, PPQ: 960, BPM: 120, Insert: InsertPosition{Mode: "end"}}
+
+	plan, err := PlanMIDI(opts, nopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := plan.clone()
+
+	plan.delete(0)         // A2 A3
+	plan.duplicate(1)      // A2 A3 A3
+	plan.rename(2, "Copy") // A2 A3 Copy
+	plan.move(2, 0)        // Copy A2 A3
+	if err := plan.setChannel(0, 16); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.setChannel(1, 17); err == nil {
+		t.Error("channel 17 should be an error")
+	}
+	if plan.Tracks[2].Index != 3 || !plan.Edited {
+		t.Errorf("edited plan is %+v", plan)
+	}
+
+	if err := WritePlan(context.Background(), plan, opts, nopLogger); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readMIDIFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, track := range file.tracks[1:] {
+		name, _ := trackName(track)
+		names = append(names, name)
+	}
+	channels, _ := trackChannels(file.tracks[1])
+	if want := []string{"Copy", "A2", "A3"}; !reflect.DeepEqual(names, want) || !channels[16] {
+		t.Errorf("wrote tracks %q (first on channel 16: %v), want %q", names, channels[16], want)
+	}
+
+	// the stale plan was made before the file existed
+	before, _ := os.ReadFile(path)
+	if err := WritePlan(context.Background(), stale, opts, nopLogger); err == nil {
+		t.Error("writing a plan for a file that changed should be an error")
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("a refused plan changed the file")
+	}
+}
+
+// a tempo too slow for the 3 byte tempo event is refused instead of writing a corrupt event
+func TestRewriteConductorBPM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.mid")
+	createGoldenFile(t, goldenCases()[0], path)
+	before, _ := os.ReadFile(path)
+
+	for _, bpm := range []int{-1, 1, 3, 65536} {
+		if err := RewriteConductor(path, path, ConductorOptions{Mode: "set-tempo", BPM: bpm}, nopLogger); err == nil {
+			t.Errorf("bpm %v should be an error", bpm)
+		}
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("a refused tempo changed the file")
+	}
+	if err := RewriteConductor(path, path, ConductorOptions{Mode: "set-tempo", BPM: 4}, nopLogger); err != nil {
+		t.Errorf("bpm 4: %v", err)
+	}
+}
+
+// a ppq that does not fit the header is refused before anything is written,
+// 0 keeps the first file's
+func TestCombinePPQ(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.mid"), filepath.Join(dir, "b.mid")
+	createGoldenFile(t, goldenCases()[0], a)
+	createGoldenFile(t, goldenCases()[1], b) // 96 ppq
+
+	tests := []struct {
+		name    string
+		combine func(out string, ppq int) error
+	}{
+		{"merge", func(out string, ppq int) error {
+			return MergeMIDIFiles([]string{a, b}, out, MergeOptions{PPQ: ppq}, nopLogger)
+		}},
+		{"join", func(out string, ppq int) error {
+			return ConcatMIDIFiles([]string{a, b}, out, ConcatOptions{PPQ: ppq}, nopLogger)
+		}},
+	}
+
+	for _, tt := range tests {
+		out := filepath.Join(dir, tt.name+".mid")
+		for _, ppq := range []int{-1, 0x8000, 0x10000} {
+			if err := tt.combine(out, ppq); err == nil {
+				t.Errorf("%v: ppq %v should be an error", tt.name, ppq)
+			}
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("%v: a refused ppq wrote the output", tt.name)
+		}
+
+		for ppq, want := range map[int]int{0: 960, 480: 480} {
+			if err := tt.combine(out, ppq); err != nil {
+				t.Errorf("%v: ppq %v: %v", tt.name, ppq, err)
+				continue
+			}
+			file, err := readMIDIFile(out)
+			if err != nil {
+				t.Fatalf("%v: %v", tt.name, err)
+			}
+			if file.header.division != want {
+				t.Errorf("%v: ppq %v wrote division %v, want %v", tt.name, ppq, file.header.division, want)
+			}
+		}
+	}
+}
+
+// a huge delta time costs no memory, only the ticks notes are on are kept
+func TestAnalyzeLongGap(t *testing.T) {
+	on := func(tick uint64, key byte) timedEvent {
+		return timedEvent{tick, midiEvent{status: 0x90, data: []byte{key, 100}}}
+	}
+	off := func(tick uint64, key byte) timedEvent {
+		return timedEvent{tick, midiEvent{status: 0x80, data: []byte{key, 0}}}
+	}
+	file := &midiFile{header: midiHeader{format: 1, division: 960}, tracks: [][]byte{
+		encodeTrack(nil, false),
+		encodeTrack([]timedEvent{on(0, 60), on(10, 61), off(0x0FFFFFFF, 60), off(0x0FFFFFFF, 61)}, false),
+		encodeTrack([]timedEvent{on(0x0FFFFFF0, 62), off(0x0FFFFFFE, 62)}, false),
+	}}
+	path := filepath.Join(t.TempDir(), "gap.mid")
+	if err := file.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := AnalyzeMIDIFile(path, nopLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalNotes != 3 || stats.MaxNPS != 2 || stats.MaxNPSAt != 0 || stats.PeakPolyphony != 3 {
+		t.Errorf("got %+v", stats)
+	}
+}
+
+// parts whose labels make the same file name are all written
+func TestSplitCollidingNames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "song.mid")
+	createGoldenFile(t, goldenCases()[4], path)
+	file, err := readMIDIFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// all three labels become song_Melody_1.mid
+	if err := SplitMIDIFile(path, dir, SplitOptions{Mode: "name", Value: "Melody 1,Melody?1,Melody*1"}, nopLogger); err != nil {
+		t.Fatal(err)
+	}
+	outputs, _ := filepath.Glob(filepath.Join(dir, "song_*.mid"))
+	if len(outputs) != 3 {
+		t.Errorf("wrote %v, want 3 files", outputs)
+	}
+	for _, out := range outputs {
+		if count, err := ReadMIDITracks(out, nopLogger); err != nil || count > len(file.tracks) {
+			t.Errorf("%v: %v tracks, %v", out, count, err)
+		}
+	}
+}
+
+// raising the ppq can make a gap too long for one delta time, the file must still read back
+func TestResampleLongGap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gap.mid")
+	file := &midiFile{header: midiHeader{format: 1, division: 960}, tracks: [][]byte{
+		encodeTrack(nil, false),
+		encodeTrack([]timedEvent{
+			{0, midiEvent{status: 0x90, data: []byte{60, 100}}},
+			{0x0F000000, midiEvent{status: 0x80, data: []byte{60, 0}}},
+		}, true),
+	}}
+	if err := file.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ResampleMIDIFile(path, path, ResampleOptions{PPQ: 7680, RunningStatus: true}, nopLogger); err != nil {
+		t.Fatal(err)
+	}
+	resampled, err := readMIDIFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := decodeTrack(resampled.tracks[1])
+	if err != nil {
+		t.Fatalf("resampled track does not read back: %v", err)
+	}
+
+	var noteTicks []uint64
+	for _, ev := range events {
+		if ev.isNoteOn() || ev.isNoteOff() {
+			noteTicks = append(noteTicks, ev.tick)
+		}
+	}
+	if want := []uint64{0, 0x0F000000 * 8}; !reflect.DeepEqual(noteTicks, want) {
+		t.Errorf("notes on ticks %#x, want %#x", noteTicks, want)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// how the created tracks are ordered in the output
+//
+// grouped:     all tracks of the first group, then the second group, ...
+// interleaved: one track of each group in turn (M, A, M, A, ...)
+// channel:     sorted by channel, keeping the group order for equal channels
+// custom:      group names repeated until every track is placed, e.g. "Melody,Melody,Art"
+var trackOrders = []string{"grouped", "interleaved", "channel", "custom"}
+
+type TrackOrder struct {
+	Mode    string
+	Pattern string // only used by custom
+}
+
+func orderTracks(tracks []PlannedTrack, groupCount int, order TrackOrder) []PlannedTrack {
+	switch order.Mode {
+	case "interleaved":
+		return interleaveTracks(tracks, groupCount, nil)
+	case "channel":
+		sorted := append([]PlannedTrack{}, tracks...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Channel < sorted[j].Channel
+		})
+		return sorted
+	case "custom":
+		return customOrderTracks(tracks, groupCount, order.Pattern)
+	default:
+		return tracks
+	}
+}
+
+// interleaveTracks takes one track from each group in pattern order until every group is empty
+// a nil pattern means every group once, in group order
+func interleaveTracks(tracks []PlannedTrack, groupCount int, pattern []int) []PlannedTrack {
+	queues := make([][]PlannedTrack, groupCount)
+	for _, t := range tracks {
+		queues[t.groupIndex] = append(queues[t.groupIndex], t)
+	}
+
+	if pattern == nil {
+		for i := 0; i < groupCount; i++ {
+			pattern = append(pattern, i)
+		}
+	}
+
+	var ordered []PlannedTrack
+	for len(ordered) < len(tracks) {
+		placed := false
+		for _, g := range pattern {
+			if len(queues[g]) == 0 {
+				continue
+			}
+			ordered = append(ordered, queues[g][0])
+			queues[g] = queues[g][1:]
+			placed = true
+		}
+
+		if !placed {
+			break
+		}
+	}
+
+	// anything not in the pattern goes at the end, grouped
+	for _, q := range queues {
+		ordered = append(ordered, q...)
+	}
+
+	return ordered
+}
+
+func customOrderTracks(tracks []PlannedTrack, groupCount int, pattern string) []PlannedTrack {
+	groupIndexes := map[string]int{}
+	for _, t := range tracks {
+		groupIndexes[strings.ToLower(t.Group)] = t.groupIndex
+	}
+
+	var order []int
+	for _, name := range strings.Split(pattern, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if i, ok := groupIndexes[name]; ok {
+			order = append(order, i)
+		} else if name != "" {
+			appLog.Debugf("custom track order: no tracks for group %v, ignoring", name)
+		}
+	}
+
+	if len(order) == 0 {
+		appLog.Debugf("custom track order is empty, using grouped order")
+		return tracks
+	}
+
+	return interleaveTracks(tracks, groupCount, order)
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// PlannedTrack is a track that will be created, before it is turned into bytes
+type PlannedTrack struct {
+	Index    int    `json:"index"` // index in the output file, 0 is the conductor track
+	Group    string `json:"group"`
+	Name     string `json:"name"`
+	Channel  int    `json:"channel"` // 1-16
+	Port     int    `json:"port"`    // 0 writes no port event
+	Program  int    `json:"program"`
+	Drums    bool   `json:"drums"`
+	DrumMode string `json:"drumMode,omitempty"`
+
+	groupIndex int
+}
+
+// setup is the extra events (with delta times) written before the program change
+func (t PlannedTrack) setup() []byte {
+	var setup []byte
+	if t.Port > 0 {
+		// delta time, meta event, midi port, 1 byte
+		setup = append(setup, 0x00, 0xFF, 0x21, 0x01, byte(t.Port))
+	}
+	if t.Drums {
+		setup = append(setup, drumPartSysex(t.DrumMode, t.Channel)...)
+	}
+
+	return setup
+}
+
+// SkippedTrack is a track that would have been on channel 10 in a group
+// that does not allow drums, it moves to the next channel instead
+type SkippedTrack struct {
+	Group string `json:"group"`
+	N     int    `json:"n"` // the track number in the group
+}
+
+// TrackPlan is every track that will be written, in order
+// it can be edited before it is written (see WritePlan)
+type TrackPlan struct {
+	Path           string         `json:"path,omitempty"`
+	NewFile        bool           `json:"newFile"`
+	ExistingTracks int            `json:"existingTracks"` // tracks already in the file
+	Insert         InsertPosition `json:"insert"`
+	Tracks         []PlannedTrack `json:"tracks"`
+	Skipped        []SkippedTrack `json:"skipped"`
+	Edited         bool           `json:"edited,omitempty"` // tracks were changed by hand after planning
+
+	first int // index of the first track, kept when tracks are edited
+}
+
+// planTracks works out the tracks of the groups in the order they are written,
+// indexed as if they go into a new file
+func planTracks(groups []TrackGroup, order TrackOrder, logger *Logger) (*TrackPlan, error) {
+	if err := validateTrackGroups(groups); err != nil {
+		return nil, err
+	}
+	if totalTrackCount(groups) == 0 {
+		return nil, errors.New("no tracks to create")
+	}
+
+	plan := &TrackPlan{NewFile: true, Skipped: []SkippedTrack{}}
+	var tracks []PlannedTrack
+	for i, group := range groups {
+		planned, skipped, err := planGroupTracks(i, group, logger)
+		if err != nil {
+			return nil, fmt.Errorf("group %v (%v): %w", i+1, group.Name, err)
+		}
+		tracks = append(tracks, planned...)
+		plan.Skipped = append(plan.Skipped, skipped...)
+	}
+
+	logger.Debugf("ordering %v tracks by %v", len(tracks), order.Mode)
+	plan.Tracks = orderTracks(tracks, len(groups), order)
+	plan.setFirstIndex(1)
+
+	return plan, nil
+}
+
+func planGroupTracks(groupIndex int, group TrackGroup, logger *Logger) ([]PlannedTrack, []SkippedTrack, error) {
+	var tracks []PlannedTrack
+	var skipped []SkippedTrack
+
+	channels, err := group.channelSet()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groupLog := logger.With(groupField(group.Name))
+	groupLog.Debug("creating tracks", Field{"count", group.Count}, Field{"channels", group.Channels})
+
+	currentTrack := -1
+	for i := 0; i < group.Count; i++ {
+		currentTrack = (currentTrack + 1) % len(channels)
+		channel := channels[currentTrack]
+
+		if !group.allowsDrumChannel() && channel == 10 {
+			groupLog.Info("skipping drum channel", Field{"n", i + 1})
+			skipped = append(skipped, SkippedTrack{Group: group.Name, N: i + 1})
+			i--
+			continue
+		}
+
+		track := PlannedTrack{
+			Group:      group.Name,
+			Name:       group.trackName(i+1, channel),
+			Channel:    channel,
+			Port:       group.Port,
+			Program:    group.Program,
+			groupIndex: groupIndex,
+		}
+
+		if group.Drums {
+			track.Drums = true
+			track.DrumMode = group.DrumMode
+			groupLog.Info("adding drum track", Field{"n", i + 1}, channelField(channel), Field{"kit", drumKitName(group.Program)})
+		} else {
+			groupLog.Info("adding track", Field{"n", i + 1}, channelField(channel))
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	return tracks, skipped, nil
+}
+
+func (p *TrackPlan) setFirstIndex(first int) {
+	p.first = first
+	p.reindex()
+}
+
+func (p *TrackPlan) reindex() {
+	for i := range p.Tracks {
+		p.Tracks[i].Index = p.first + i
+	}
+}
+
+// clone copies the plan so it can be edited or written while the original changes
+func (p *TrackPlan) clone() *TrackPlan {
+	c := *p
+	c.Tracks = append([]PlannedTrack{}, p.Tracks...)
+	c.Skipped = append([]SkippedTrack{}, p.Skipped...)
+	return &c
+}
+
+// the edits below change track i of the plan and keep the indexes in order
+
+func (p *TrackPlan) rename(i int, name string) {
+	p.Tracks[i].Name = name
+	p.Edited = true
+}
+
+// a gm drum track moved off channel 10 becomes a normal track,
+// gs and xg drum tracks stay drums on their new channel
+func (p *TrackPlan) setChannel(i int, channel int) error {
+	if channel < 1 || channel > 16 {
+		return errors.New("channel must be between 1 and 16")
+	}
+	t := &p.Tracks[i]
+	t.Channel = channel
+	if t.Drums && gmDrumMode(t.DrumMode) && channel != 10 {
+		t.Drums, t.DrumMode = false, ""
+	}
+	p.Edited = true
+	return nil
+}
+
+func (p *TrackPlan) setProgram(i int, program int) error {
+	if program < 0 || program > 127 {
+		return errors.New("program must be between 0 and 127")
+	}
+	p.Tracks[i].Program = program
+	p.Edited = true
+	return nil
+}
+
+// move moves track i to index to, the tracks between shift over
+func (p *TrackPlan) move(i int, to int) {
+	if to < 0 || to >= len(p.Tracks) || to == i {
+		return
+	}
+	track := p.Tracks[i]
+	p.Tracks = append(p.Tracks[:i], p.Tracks[i+1:]...)
+	p.Tracks = append(p.Tracks[:to], append([]PlannedTrack{track}, p.Tracks[to:]...)...)
+	p.reindex()
+	p.Edited = true
+}
+
+func (p *TrackPlan) delete(i int) {
+	p.Tracks = append(p.Tracks[:i], p.Tracks[i+1:]...)
+	p.reindex()
+	p.Edited = true
+}
+
+// duplicate adds a copy of track i after it
+func (p *TrackPlan) duplicate(i int) {
+	p.Tracks = append(p.Tracks[:i+1], append([]PlannedTrack{p.Tracks[i]}, p.Tracks[i+1:]...)...)
+	p.reindex()
+	p.Edited = true
+}
+
+// validate checks the tracks can be written, e.g. after editing them or reading them from JSON
+func (p *TrackPlan) validate() error {
+	if len(p.Tracks) == 0 {
+		return errors.New("no tracks to create")
+	}
+	for i, t := range p.Tracks {
+		var err error
+		switch {
+		case t.Channel < 1 || t.Channel > 16:
+			err = errors.New("channel must be between 1 and 16")
+		case t.Program < 0 || t.Program > 127:
+			err = errors.New("program must be between 0 and 127")
+		case t.Port < 0 || t.Port > 255:
+			err = errors.New("port must be between 0 and 255")
+		case t.Drums && !validDrumMode(t.DrumMode):
+			err = errors.New("drum mode must be gm, gs or xg")
+		}
+		if err != nil {
+			return fmt.Errorf("track %v (%v): %w", i+1, t.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// PlanMIDI works out what CreateMIDI will write without writing anything,
+// pass a nil logger to keep it quiet (e.g. for a preview)
+func PlanMIDI(opts CreateOptions, logger *Logger) (*TrackPlan, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	newTracks := totalTrackCount(opts.Groups)
+	trackCount := newTracks
+	groups := opts.Groups
+
+	_, err := os.Stat(opts.Path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, ioError("open", opts.Path, err)
+	}
+
+	existing := 0
+	if exists {
+		logger.Debugf("File input exists, reading track count from file")
+
+		existing, err = ReadMIDITracks(opts.Path, logger)
+		if err != nil {
+			return nil, err
+		}
+		trackCount = existing + newTracks
+	} else {
+		logger.Debugf("File input does not exist, continuing with new file")
+	}
+
+	// a new file also gets a conductor track
+	fileTracks := trackCount
+	if !exists {
+		fileTracks++
+	}
+	if fileTracks > maxTracks {
+		logger.Debugf("Track count would be too high (%d > %d)", fileTracks, maxTracks)
+		return nil, &TrackLimitError{Count: fileTracks}
+	}
+
+	if hasAutoChannels(groups) {
+		var usage channelUsage
+		if exists {
+			usage, err = readChannelUsage(opts.Path)
+			if err != nil {
+				logger.Warnf("could not read the channels of the file, treating every channel as free: %v", err)
+			}
+		}
+		groups = resolveAutoChannels(groups, usage, logger)
+	}
+
+	logger.Debugf("creating %v tracks in %v groups", newTracks, len(groups))
+	plan, err := planTracks(groups, opts.Order, logger)
+	if err != nil {
+		return nil, err
+	}
+	plan.Path = opts.Path
+	plan.NewFile = !exists
+	plan.ExistingTracks = existing
+	plan.Insert = opts.Insert
+
+	if exists {
+		first, err := planInsertIndex(opts.Path, existing, opts.Insert)
+		if err != nil {
+			return nil, err
+		}
+		plan.setFirstIndex(first)
+	}
+
+	return plan, nil
+}
+
+// planInsertIndex is the index the first new track gets in an existing file
+func planInsertIndex(path string, existing int, insert InsertPosition) (int, error) {
+	switch insert.Mode {
+	case "", "end":
+		return existing, nil
+	case "after-track":
+		// the same check as insertIndex, without reading the tracks
+		if insert.Value < 0 || insert.Value >= existing {
+			return 0, fmt.Errorf("track %v does not exist (file has tracks 0-%v)", insert.Value, existing-1)
+		}
+		return insert.Value + 1, nil
+	default:
+		file, err := readMIDIFile(path)
+		if err != nil {
+			return 0, err
+		}
+		return insertIndex(file, insert)
+	}
+}
+
+// planColumns are the columns of the plan table, in the cli and the gui
+var planColumns = []string{"#", "group", "name", "channel", "port", "program"}
+
+// cell is the text of column col (see planColumns) for the track
+func (t PlannedTrack) cell(col int) string {
+	switch col {
+	case 0:
+		return fmt.Sprint(t.Index)
+	case 1:
+		return t.Group
+	case 2:
+		return t.Name
+	case 3:
+		return fmt.Sprint(t.Channel)
+	case 4:
+		return fmt.Sprint(t.Port)
+	case 5:
+		if t.Drums {
+			return fmt.Sprintf("%v (%v)", t.Program, drumKitName(t.Program))
+		}
+		return fmt.Sprint(t.Program)
+	default:
+		return ""
+	}
+}
+
+// Summary is one line about where the tracks go
+func (p *TrackPlan) Summary() string {
+	var s string
+	switch {
+	case p.NewFile:
+		s = fmt.Sprintf("%v tracks in a new file", len(p.Tracks))
+	case len(p.Tracks) > 0:
+		s = fmt.Sprintf("%v tracks added to %v existing tracks, from track %v", len(p.Tracks), p.ExistingTracks, p.Tracks[0].Index)
+	default:
+		s = fmt.Sprintf("no tracks added to %v existing tracks", p.ExistingTracks)
+	}
+	if p.Edited {
+		s += " (edited)"
+	}
+	if len(p.Skipped) > 0 {
+		s += ", skipped channel 10 for " + p.skippedSummary()
+	}
+
+	return s
+}
+
+func (p *TrackPlan) writeTable(w io.Writer) error {
+	if p.Path != "" {
+		fmt.Fprintf(w, "output: %v\n", p.Path)
+	}
+	fmt.Fprintf(w, "%v\n\n", p.Summary())
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(planColumns, "\t"))
+	for _, t := range p.Tracks {
+		cells := make([]string, len(planColumns))
+		for col := range cells {
+			cells[col] = t.cell(col)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// skippedSummary lists the skipped tracks as "group n", e.g. "Melody 10, Melody 26"
+func (p *TrackPlan) skippedSummary() string {
+	var names []string
+	for _, s := range p.Skipped {
+		names = append(names, fmt.Sprintf("%v %v", s.Group, s.N))
+	}
+	return strings.Join(names, ", ")
+}
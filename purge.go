@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+type PurgeOptions struct {
+	// keep tracks without notes that still have controller, pitch bend,
+	// sysex or meta events (other than the track name, port and end of track)
+	KeepControlTracks bool
+}
+
+// isEmptyTrack reports whether a track has no notes
+// with KeepControlTracks, only tracks like the ones createTrack writes
+// (track name, program change, end of track) count as empty
+func isEmptyTrack(track []byte, opts PurgeOptions) (bool, error) {
+	er := newEventReader(bytes.NewReader(track))
+	for {
+		ev, err := er.next()
+		if errors.Is(err, io.EOF) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if ev.isNoteOn() {
+			return false, nil
+		}
+		if !opts.KeepControlTracks {
+			continue
+		}
+
+		switch {
+		case ev.status == 0xff:
+			// track name, channel prefix, port and end of track
+			if ev.meta != 0x03 && ev.meta != 0x20 && ev.meta != 0x21 && ev.meta != 0x2f {
+				return false, nil
+			}
+		case ev.isChannelEvent():
+			// program changes and note offs don't make a track worth keeping
+			if ev.status&0xf0 != 0xc0 && !ev.isNoteOff() {
+				return false, nil
+			}
+		default:
+			return false, nil // sysex
+		}
+	}
+}
+
+// PurgeEmptyTracks removes every track without notes from the file at inputPath
+// and saves it to outputPath. The first (conductor) track is always kept
+func PurgeEmptyTracks(inputPath string, outputPath string, opts PurgeOptions, logger *Logger) error {
+	file, err := readMIDIFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	var indexes []int
+	for i := 1; i < len(file.tracks); i++ {
+		empty, err := isEmptyTrack(file.tracks[i], opts)
+		if err != nil {
+			logger.With(trackField(i)).Warnf("could not read the track, keeping it: %v", err)
+			continue
+		}
+		if !empty {
+			continue
+		}
+
+		name, _ := trackName(file.tracks[i])
+		logger.Info("removing empty track", trackField(i), Field{"name", name})
+		indexes = append(indexes, i)
+	}
+
+	if len(indexes) == 0 {
+		logger.Infof("no empty tracks found, nothing removed")
+		return nil
+	}
+
+	deleteTracks(file, indexes)
+
+	logger.Infof("removed %v empty tracks, %v tracks left", len(indexes), len(file.tracks))
+	return file.save(outputPath)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChannelRule moves the channel events of one channel to another channel
+type ChannelRule struct {
+	From   int   // 1-16
+	To     int   // 1-16
+	Port   int   // midi port (0-255) set on the tracks that had events moved, -1 keeps the port
+	Tracks []int // track indexes the rule applies to, empty is every track
+}
+
+type RemapOptions struct {
+	Rules         []ChannelRule
+	DryRun        bool // only log what would be moved
+	RunningStatus bool // leave out repeated status bytes in the changed tracks
+}
+
+// parseChannelRule parses from:to[@port][/tracks], e.g. 16:14, 1:2@1 or 10:11/3,5-8
+func parseChannelRule(s string) (ChannelRule, error) {
+	rule := ChannelRule{Port: -1}
+
+	s, tracks, hasTracks := strings.Cut(strings.TrimSpace(s), "/")
+	if hasTracks {
+		indexes, err := parseIndexList(tracks)
+		if err != nil {
+			return rule, fmt.Errorf("%q: %w", s, err)
+		}
+		rule.Tracks = indexes
+	}
+
+	s, port, hasPort := strings.Cut(s, "@")
+	if hasPort {
+		n, err := strconv.Atoi(strings.TrimSpace(port))
+		if err != nil || n < 0 || n > 255 {
+			return rule, fmt.Errorf("%q: port must be between 0 and 255", s)
+		}
+		rule.Port = n
+	}
+
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		return rule, fmt.Errorf("%q is not from:to", s)
+	}
+	var err error
+	if rule.From, err = strconv.Atoi(strings.TrimSpace(from)); err != nil || rule.From < 1 || rule.From > 16 {
+		return rule, fmt.Errorf("%q: channel %v is not between 1 and 16", s, from)
+	}
+	if rule.To, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || rule.To < 1 || rule.To > 16 {
+		return rule, fmt.Errorf("%q: channel %v is not between 1 and 16", s, to)
+	}
+
+	return rule, nil
+}
+
+// parseChannelRules parses rules separated by spaces or new lines
+func parseChannelRules(s string) ([]ChannelRule, error) {
+	var rules []ChannelRule
+	for _, field := range strings.Fields(s) {
+		rule, err := parseChannelRule(field)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (r ChannelRule) appliesTo(track int) bool {
+	if len(r.Tracks) == 0 {
+		return true
+	}
+	for _, i := range r.Tracks {
+		if i == track {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r ChannelRule) String() string {
+	s := fmt.Sprintf("ch%v -> ch%v", r.From, r.To)
+	if r.Port >= 0 {
+		s += fmt.Sprintf(" port %v", r.Port)
+	}
+	return s
+}
+
+// setTrackPort replaces the midi port events of a track (ff 21 01 pp) with one at the start
+func setTrackPort(events []timedEvent, port int) []timedEvent {
+	kept := []timedEvent{{midiEvent: midiEvent{status: 0xff, meta: 0x21, data: []byte{byte(port)}}}}
+	for _, ev := range events {
+		if !(ev.status == 0xff && ev.meta == 0x21) {
+			kept = append(kept, ev)
+		}
+	}
+
+	return kept
+}
+
+// remapTrack moves the channel events of the track, a rule only matches the channel an event
+// had before remapping, so with 1:2 2:3 no event is moved twice
+// returns the events moved by each rule and the port to set, -1 if none
+func remapTrack(index int, events []timedEvent, rules []ChannelRule) ([]int, int) {
+	moved := make([]int, len(rules))
+	port := -1
+
+	for i, ev := range events {
+		if !ev.isChannelEvent() {
+			continue
+		}
+
+		ch := ev.channel()
+		for j, rule := range rules {
+			if rule.From != ch || !rule.appliesTo(index) {
+				continue
+			}
+
+			events[i].status = ev.status&0xf0 | byte(rule.To-1)
+			moved[j]++
+			if rule.Port >= 0 {
+				port = rule.Port
+			}
+			break
+		}
+	}
+
+	return moved, port
+}
+
+// remapFile applies the rules to every track and logs what was moved
+// returns the number of events moved
+func remapFile(file *midiFile, opts RemapOptions, logger *Logger) (int, error) {
+	rules := opts.Rules
+	total := 0
+	for i, track := range file.tracks {
+		events, err := decodeTrack(track)
+		if err != nil {
+			return 0, fmt.Errorf("track %v: %w", i, err)
+		}
+
+		moved, port := remapTrack(i, events, rules)
+		changed := false
+		name := eventsTrackName(events)
+		for j, n := range moved {
+			if n > 0 {
+				logger.With(trackField(i), Field{"name", name}).Infof("%v events %v", n, rules[j])
+				total += n
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if port >= 0 {
+			events = setTrackPort(events, port)
+		}
+		file.tracks[i] = encodeTrack(events, opts.RunningStatus)
+	}
+
+	return total, nil
+}
+
+// RemapChannels moves channel events to other channels, with DryRun only the summary is logged
+func RemapChannels(inputPath string, outputPath string, opts RemapOptions, logger *Logger) error {
+	if len(opts.Rules) == 0 {
+		return fmt.Errorf("no channel rules given")
+	}
+
+	file, err := readMIDIFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	total, err := remapFile(file, opts, logger)
+	if err != nil {
+		return err
+	}
+
+	if total == 0 {
+		logger.Infof("no events matched the rules, nothing changed")
+		return nil
+	}
+	if opts.DryRun {
+		logger.Infof("dry run: %v events would be moved, the file was not changed", total)
+		return nil
+	}
+
+	logger.Infof("moved %v events", total)
+	return file.save(outputPath)
+}
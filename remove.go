@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// which tracks to remove from a file, any combination can be used
+// track indexes start at 0, the first (conductor) track
+type RemoveOptions struct {
+	Indexes     []int
+	NamePattern string // glob pattern matched against track names, e.g. "Art*"
+	Last        int    // the last N tracks, e.g. the ones appended by the last run
+}
+
+func (o RemoveOptions) empty() bool {
+	return len(o.Indexes) == 0 && o.NamePattern == "" && o.Last == 0
+}
+
+// matchTrackName matches a track name against a glob pattern, ignoring case
+func matchTrackName(pattern string, name string) (bool, error) {
+	return path.Match(strings.ToLower(pattern), strings.ToLower(name))
+}
+
+// tracksToRemove returns the sorted indexes of the tracks matched by the options
+// the first track is only removed when its index is given, so the tempo map is
+// never dropped by a name pattern or by removing the last tracks
+func tracksToRemove(file *midiFile, opts RemoveOptions) ([]int, error) {
+	remove := make([]bool, len(file.tracks))
+
+	for _, i := range opts.Indexes {
+		if i < 0 || i >= len(file.tracks) {
+			return nil, fmt.Errorf("track %v does not exist (file has tracks 0-%v)", i, len(file.tracks)-1)
+		}
+		remove[i] = true
+	}
+
+	if opts.NamePattern != "" {
+		if _, err := path.Match(opts.NamePattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern: %w", err)
+		}
+
+		for i := 1; i < len(file.tracks); i++ {
+			name, err := trackName(file.tracks[i])
+			if err != nil {
+				return nil, fmt.Errorf("track %v: %w", i, err)
+			}
+			if ok, _ := matchTrackName(opts.NamePattern, name); ok {
+				remove[i] = true
+			}
+		}
+	}
+
+	if opts.Last < 0 {
+		return nil, fmt.Errorf("cannot remove %v tracks", opts.Last)
+	}
+	for i := len(file.tracks) - opts.Last; i < len(file.tracks); i++ {
+		if i >= 1 {
+			remove[i] = true
+		}
+	}
+
+	var indexes []int
+	for i, r := range remove {
+		if r {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes, nil
+}
+
+// deleteTracks removes the tracks at the given sorted indexes
+func deleteTracks(file *midiFile, indexes []int) {
+	var kept [][]byte
+	next := 0
+	for i, track := range file.tracks {
+		if next < len(indexes) && indexes[next] == i {
+			next++
+			continue
+		}
+		kept = append(kept, track)
+	}
+
+	file.tracks = kept
+}
+
+// RemoveMIDITracks removes tracks from the file at inputPath and saves it to outputPath
+// (which can be the same path)
+func RemoveMIDITracks(inputPath string, outputPath string, opts RemoveOptions, logger *Logger) error {
+	if opts.empty() {
+		return fmt.Errorf("no tracks selected for removal")
+	}
+
+	file, err := readMIDIFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	indexes, err := tracksToRemove(file, opts)
+	if err != nil {
+		return err
+	}
+	if len(indexes) == 0 {
+		logger.Infof("no tracks matched, nothing removed")
+		return nil
+	}
+
+	for _, i := range indexes {
+		name, _ := trackName(file.tracks[i])
+		logger.Info("removing track", trackField(i), Field{"name", name})
+	}
+
+	deleteTracks(file, indexes)
+
+	logger.Infof("removed %v tracks, %v tracks left", len(indexes), len(file.tracks))
+	return file.save(outputPath)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+)
+
+// how ticks that fall between two ticks of the new resolution are rounded
+var roundingModes = []string{"nearest", "down", "up"}
+
+type ResampleOptions struct {
+	PPQ      int    // new resolution
+	Rounding string // nearest, down or up, empty is nearest
+
+	// notes are made at least this many ticks (at the new ppq) long,
+	// notes that had a length are never made 0 ticks long even if this is 0
+	MinNoteLength int
+
+	RunningStatus bool // leave out repeated status bytes in the rescaled tracks
+}
+
+func rescaleTickRounded(tick uint64, from int, to int, rounding string) uint64 {
+	switch rounding {
+	case "down":
+		return tick * uint64(to) / uint64(from)
+	case "up":
+		return (tick*uint64(to) + uint64(from) - 1) / uint64(from)
+	default:
+		return rescaleTick(tick, from, to)
+	}
+}
+
+// keepNoteLengths moves note offs so every note is at least minLength ticks long,
+// without moving past the next note on of the same key
+// before holds the ticks from before rescaling, to find notes that had a length
+// returns how many notes were made longer
+func keepNoteLengths(events []timedEvent, before []uint64, minLength uint64) int {
+	if minLength == 0 {
+		minLength = 1
+	}
+
+	// note ons waiting for their note off, oldest first
+	var open [16][128][]int
+	// the next note on of the same key after each note on
+	next := make(map[int]int)
+	var last [16][128]int
+	for ch := range last {
+		for key := range last[ch] {
+			last[ch][key] = -1
+		}
+	}
+
+	for i, ev := range events {
+		if ev.isNoteOn() {
+			ch, key := ev.status&0x0f, ev.data[0]
+			if last[ch][key] >= 0 {
+				next[last[ch][key]] = i
+			}
+			last[ch][key] = i
+		}
+	}
+
+	lengthened := 0
+	for i, ev := range events {
+		ch, key := ev.status&0x0f, byte(0)
+		if len(ev.data) > 0 {
+			key = ev.data[0]
+		}
+
+		switch {
+		case ev.isNoteOn():
+			open[ch][key] = append(open[ch][key], i)
+		case ev.isNoteOff():
+			if len(open[ch][key]) == 0 {
+				continue
+			}
+			on := open[ch][key][0]
+			open[ch][key] = open[ch][key][1:]
+
+			// notes that were 0 ticks long stay that way
+			if before[i] == before[on] || ev.tick-events[on].tick >= minLength {
+				continue
+			}
+
+			end := events[on].tick + minLength
+			if n, ok := next[on]; ok && events[n].tick < end {
+				end = events[n].tick
+			}
+			if end > ev.tick {
+				events[i].tick = end
+				lengthened++
+			}
+		}
+	}
+
+	return lengthened
+}
+
+// resampleTrack rescales a track to a new resolution, returns how many notes were made longer
+func resampleTrack(track []byte, from int, opts ResampleOptions) ([]byte, int, error) {
+	events, err := decodeTrack(track)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	before := make([]uint64, len(events))
+	for i := range events {
+		before[i] = events[i].tick
+		events[i].tick = rescaleTickRounded(events[i].tick, from, opts.PPQ, opts.Rounding)
+	}
+
+	lengthened := keepNoteLengths(events, before, uint64(opts.MinNoteLength))
+	sortEvents(events)
+
+	return encodeTrack(events, opts.RunningStatus), lengthened, nil
+}
+
+func resampleFile(file *midiFile, opts ResampleOptions, logger *Logger) error {
+	from := file.header.division
+	if from == opts.PPQ {
+		logger.Infof("file is already %v ppq", from)
+	}
+
+	for i, track := range file.tracks {
+		resampled, lengthened, err := resampleTrack(track, from, opts)
+		if err != nil {
+			return fmt.Errorf("track %v: %w", i, err)
+		}
+		if lengthened > 0 {
+			logger.With(trackField(i)).Infof("made %v notes longer", lengthened)
+		}
+		file.tracks[i] = resampled
+	}
+
+	file.header.division = opts.PPQ
+	return nil
+}
+
+// validatePPQ checks a resolution fits the header,
+// the top bit of the division would make it an SMPTE time division
+func validatePPQ(ppq int) error {
+	if ppq < 1 || ppq > 0x7fff {
+		return fmt.Errorf("ppq must be between 1 and %v", 0x7fff)
+	}
+
+	return nil
+}
+
+// ResampleMIDIFile changes the resolution (ppq) of a file, moving every event to the new ticks
+func ResampleMIDIFile(inputPath string, outputPath string, opts ResampleOptions, logger *Logger) error {
+	if err := validatePPQ(opts.PPQ); err != nil {
+		return err
+	}
+	if opts.Rounding != "" && opts.Rounding != "nearest" && opts.Rounding != "down" && opts.Rounding != "up" {
+		return fmt.Errorf("unknown rounding mode %v", opts.Rounding)
+	}
+	if opts.MinNoteLength < 0 {
+		return fmt.Errorf("minimum note length can not be negative")
+	}
+
+	file, err := readMIDIFile(inputPath)
+	if err != nil {
+		return err
+	}
+	if err := checkDivision(inputPath, file.header); err != nil {
+		return err
+	}
+
+	logger.Infof("rescaling %v tracks from %v to %v ppq", len(file.tracks), file.header.division, opts.PPQ)
+	if err := resampleFile(file, opts, logger); err != nil {
+		return err
+	}
+
+	return file.save(outputPath)
+}
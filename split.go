@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// how a file is split, every output keeps a copy of the first (conductor) track
+//
+// ranges:  one file per track index range, e.g. "1-4,5-8,9"
+// channel: one file per channel, each track goes to the channel most of its events are on
+// name:    one file per track name pattern, e.g. "Melody*,Art*"
+var splitModes = []string{"ranges", "channel", "name"}
+
+type SplitOptions struct {
+	Mode  string
+	Value string // ranges or name patterns, separated by commas. not used by channel
+}
+
+type splitPart struct {
+	label   string // used in the output file name
+	indexes []int  // track indexes, never 0
+}
+
+// primaryChannel returns the channel most of the track's channel events are on, or 0 if it has none
+func primaryChannel(track []byte) (int, error) {
+	counts, err := channelEventCounts(track)
+	if err != nil {
+		return 0, err
+	}
+
+	channel := 0
+	for ch := 1; ch <= 16; ch++ {
+		if counts[ch] > counts[channel] {
+			channel = ch
+		}
+	}
+
+	return channel, nil
+}
+
+func splitParts(file *midiFile, opts SplitOptions, logger *Logger) ([]splitPart, error) {
+	var parts []splitPart
+
+	switch opts.Mode {
+	case "ranges":
+		for _, r := range strings.Split(opts.Value, ",") {
+			r = strings.TrimSpace(r)
+			if r == "" {
+				continue
+			}
+			indexes, err := parseIndexList(r)
+			if err != nil {
+				return nil, err
+			}
+
+			part := splitPart{label: r}
+			for _, i := range indexes {
+				if i >= len(file.tracks) {
+					return nil, fmt.Errorf("track %v does not exist (file has tracks 0-%v)", i, len(file.tracks)-1)
+				}
+				if i > 0 {
+					part.indexes = append(part.indexes, i)
+				}
+			}
+			parts = append(parts, part)
+		}
+	case "channel":
+		var byChannel [17][]int
+		for i := 1; i < len(file.tracks); i++ {
+			ch, err := primaryChannel(file.tracks[i])
+			if err != nil {
+				return nil, fmt.Errorf("track %v: %w", i, err)
+			}
+			if ch == 0 {
+				logger.With(trackField(i)).Warnf("track has no channel events, leaving it out")
+				continue
+			}
+			byChannel[ch] = append(byChannel[ch], i)
+		}
+
+		for ch := 1; ch <= 16; ch++ {
+			if len(byChannel[ch]) > 0 {
+				parts = append(parts, splitPart{label: fmt.Sprintf("ch%v", ch), indexes: byChannel[ch]})
+			}
+		}
+	case "name":
+		names := make([]string, len(file.tracks))
+		for i := 1; i < len(file.tracks); i++ {
+			name, err := trackName(file.tracks[i])
+			if err != nil {
+				return nil, fmt.Errorf("track %v: %w", i, err)
+			}
+			names[i] = name
+		}
+
+		for _, pattern := range strings.Split(opts.Value, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+
+			part := splitPart{label: pattern}
+			for i := 1; i < len(file.tracks); i++ {
+				ok, err := matchTrackName(pattern, names[i])
+				if err != nil {
+					return nil, fmt.Errorf("invalid name pattern %v: %w", pattern, err)
+				}
+				if ok {
+					part.indexes = append(part.indexes, i)
+				}
+			}
+			parts = append(parts, part)
+		}
+	default:
+		return nil, fmt.Errorf("unknown split mode %v", opts.Mode)
+	}
+
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("nothing to split by")
+	}
+
+	return parts, nil
+}
+
+// splitFileName returns the output path of a part, e.g. song_ch16.mid
+func splitFileName(inputPath string, outputDir string, label string) string {
+	base := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+	if outputDir == "" {
+		outputDir = filepath.Dir(inputPath)
+	}
+
+	// keep the label safe to use in a file name
+	label = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, label)
+
+	return filepath.Join(outputDir, fmt.Sprintf("%v_%v.mid", base, label))
+}
+
+// SplitMIDIFile writes one file per part into outputDir (or next to the input file)
+func SplitMIDIFile(inputPath string, outputDir string, opts SplitOptions, logger *Logger) error {
+	file, err := readMIDIFile(inputPath)
+	if err != nil {
+		return err
+	}
+	if len(file.tracks) == 0 {
+		return fmt.Errorf("file has no tracks")
+	}
+
+	parts, err := splitParts(file, opts, logger)
+	if err != nil {
+		return err
+	}
+
+	// labels can make the same file name (e.g. "a/b" and "a_b"),
+	// later parts get a number so they don't overwrite the earlier ones
+	// (compared ignoring case, some file systems do)
+	used := map[string]bool{}
+
+	for _, part := range parts {
+		if len(part.indexes) == 0 {
+			logger.Warnf("%v: no tracks, skipping", part.label)
+			continue
+		}
+
+		out := &midiFile{header: file.header}
+		out.tracks = append(out.tracks, file.tracks[0])
+		for _, i := range part.indexes {
+			out.tracks = append(out.tracks, file.tracks[i])
+		}
+
+		path := splitFileName(inputPath, outputDir, part.label)
+		for n := 2; used[strings.ToLower(path)]; n++ {
+			path = splitFileName(inputPath, outputDir, fmt.Sprintf("%v_%v", part.label, n))
+		}
+		used[strings.ToLower(path)] = true
+
+		logger.Infof("%v: writing %v tracks to %v", part.label, len(part.indexes), path)
+		if err := out.save(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
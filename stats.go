@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// notes per second are counted in buckets of this many seconds,
+// so the sliding window moves in steps of 10ms
+const npsBucketSeconds = 0.01
+
+// polyphony keeps the change of every tick a note starts or ends on,
+// files with more of those ticks skip it to keep memory use bounded
+// (the ticks are stored, not the time between them, so long silences cost nothing)
+const maxPolyphonyTicks = 1 << 23
+
+type TrackStats struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Notes uint64 `json:"notes"`
+}
+
+type MIDIStats struct {
+	Path          string       `json:"path"`
+	TotalNotes    uint64       `json:"totalNotes"`
+	MaxNPS        uint64       `json:"maxNps"`        // most notes started in any 1 second window
+	MaxNPSAt      float64      `json:"maxNpsAt"`      // start of that window in seconds
+	PeakPolyphony int64        `json:"peakPolyphony"` // most notes playing at once, -1 if skipped
+	Seconds       float64      `json:"seconds"`       // time of the last event
+	Tracks        []TrackStats `json:"tracks"`
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[uint64]int32) []uint64 {
+	keys := make([]uint64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// AnalyzeMIDIFile counts notes, notes per second and polyphony
+// the file is streamed twice (tempo map, then notes) and never loaded into memory
+func AnalyzeMIDIFile(path string, logger *Logger) (*MIDIStats, error) {
+	tempo, err := ReadTempoMap(path)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("tempo map has %v changes", len(tempo.tempos))
+
+	stats := &MIDIStats{Path: path}
+	// both are keyed by position but only hold the positions notes are on,
+	// so a file with one huge delta time does not need memory for the gap
+	buckets := map[uint64]int32{} // note ons in each npsBucketSeconds
+	changes := map[uint64]int32{} // note ons minus note offs at each tick
+	polyphony := true
+
+	err = streamTracks(path, func(header midiHeader, index int, track io.ByteReader) error {
+		trackStats := TrackStats{Index: index}
+		cursor := &tempoCursor{m: tempo}
+		var active [16][128]int32
+		var tick uint64
+
+		addChange := func(tick uint64, change int32) {
+			if !polyphony {
+				return
+			}
+			changes[tick] += change
+			if len(changes) > maxPolyphonyTicks {
+				logger.Warnf("notes start or end on more than %v ticks, skipping polyphony", maxPolyphonyTicks)
+				polyphony = false
+				changes = nil
+			}
+		}
+
+		er := newEventReader(track)
+		for {
+			ev, err := er.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			tick += uint64(ev.delta)
+
+			switch {
+			case ev.isNoteOn():
+				trackStats.Notes++
+				active[ev.status&0x0f][ev.data[0]]++
+				addChange(tick, 1)
+				buckets[uint64(cursor.seconds(tick)/npsBucketSeconds)]++
+			case ev.isNoteOff():
+				if active[ev.status&0x0f][ev.data[0]] > 0 {
+					active[ev.status&0x0f][ev.data[0]]--
+					addChange(tick, -1)
+				}
+			case ev.status == 0xff && ev.meta == 0x03 && trackStats.Name == "":
+				trackStats.Name = string(ev.data)
+			}
+		}
+
+		// notes that are never turned off end with the track
+		for ch := range active {
+			for key := range active[ch] {
+				for ; active[ch][key] > 0; active[ch][key]-- {
+					addChange(tick, -1)
+				}
+			}
+		}
+
+		if seconds := cursor.seconds(tick); seconds > stats.Seconds {
+			stats.Seconds = seconds
+		}
+		stats.TotalNotes += trackStats.Notes
+		stats.Tracks = append(stats.Tracks, trackStats)
+
+		logger.Debugf("track %v: %v notes", index, trackStats.Notes)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// sliding 1 second window over the buckets that have notes,
+	// the queue holds the buckets inside the window ending at the current bucket
+	window := uint64(1 / npsBucketSeconds)
+	var queue []uint64
+	var sum uint64
+	for _, bucket := range sortedKeys(buckets) {
+		queue = append(queue, bucket)
+		sum += uint64(buckets[bucket])
+		for bucket-queue[0] >= window {
+			sum -= uint64(buckets[queue[0]])
+			queue = queue[1:]
+		}
+		if sum > stats.MaxNPS {
+			stats.MaxNPS = sum
+			var start uint64
+			if bucket >= window {
+				start = bucket - window + 1
+			}
+			stats.MaxNPSAt = float64(start) * npsBucketSeconds
+		}
+	}
+
+	stats.PeakPolyphony = -1
+	if polyphony {
+		var current int64
+		stats.PeakPolyphony = 0
+		// notes ending on a tick are let go before the ones starting on it
+		for _, tick := range sortedKeys(changes) {
+			current += int64(changes[tick])
+			if current > stats.PeakPolyphony {
+				stats.PeakPolyphony = current
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+func (s *MIDIStats) writeTable(w io.Writer) error {
+	fmt.Fprintf(w, "file:           %v\n", s.Path)
+	fmt.Fprintf(w, "notes:          %v\n", s.TotalNotes)
+	fmt.Fprintf(w, "max nps:        %v (at %.2fs)\n", s.MaxNPS, s.MaxNPSAt)
+	if s.PeakPolyphony >= 0 {
+		fmt.Fprintf(w, "peak polyphony: %v\n", s.PeakPolyphony)
+	} else {
+		fmt.Fprintf(w, "peak polyphony: skipped\n")
+	}
+	fmt.Fprintf(w, "length:         %.2fs\n\n", s.Seconds)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tname\tnotes")
+	for _, t := range s.Tracks {
+		fmt.Fprintf(tw, "%v\t%q\t%v\n", t.Index, t.Name, t.Notes)
+	}
+
+	return tw.Flush()
+}
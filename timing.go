@@ -0,0 +1,299 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+type TempoChange struct {
+	Tick                   uint64
+	MicrosecondsPerQuarter int
+}
+
+type TimeSignature struct {
+	Tick        uint64
+	Numerator   int
+	Denominator int // the actual note value, e.g. 4 or 8
+}
+
+// BarBeat is a musical position, bars and beats start at 1
+// Tick is the offset in ticks from the start of the beat
+type BarBeat struct {
+	Bar  int
+	Beat int
+	Tick int
+}
+
+func (b BarBeat) String() string {
+	return fmt.Sprintf("%v:%v:%v", b.Bar, b.Beat, b.Tick)
+}
+
+// TempoMap converts between ticks, seconds and bar:beat positions of a file
+// a new bar starts at every time signature change, even in the middle of a bar
+type TempoMap struct {
+	PPQ     int
+	EndTick uint64 // tick of the last event of the file, used by Duration
+
+	tempos     []TempoChange   // sorted, always starts at tick 0
+	seconds    []float64       // seconds at each tempo change
+	signatures []TimeSignature // sorted, always starts at tick 0
+	bars       []int           // bar each time signature starts on
+}
+
+// ticks in one bar and one beat of the time signature
+func (s TimeSignature) barTicks(ppq int) uint64 {
+	return uint64(s.Numerator * ppq * 4 / s.Denominator)
+}
+
+func (s TimeSignature) beatTicks(ppq int) uint64 {
+	return uint64(ppq * 4 / s.Denominator)
+}
+
+// NewTempoMap builds a tempo map from tempo and time signature changes in any order
+// the file starts at 120 bpm and 4/4 until the first change says otherwise
+func NewTempoMap(ppq int, tempos []TempoChange, signatures []TimeSignature) *TempoMap {
+	m := &TempoMap{PPQ: ppq}
+
+	m.tempos = append([]TempoChange{}, tempos...)
+	sort.SliceStable(m.tempos, func(i, j int) bool {
+		return m.tempos[i].Tick < m.tempos[j].Tick
+	})
+	if len(m.tempos) == 0 || m.tempos[0].Tick > 0 {
+		m.tempos = append([]TempoChange{{Tick: 0, MicrosecondsPerQuarter: 500_000}}, m.tempos...)
+	}
+
+	m.seconds = make([]float64, len(m.tempos))
+	for i := 1; i < len(m.tempos); i++ {
+		prev := m.tempos[i-1]
+		m.seconds[i] = m.seconds[i-1] + float64(m.tempos[i].Tick-prev.Tick)*float64(prev.MicrosecondsPerQuarter)/1e6/float64(ppq)
+	}
+
+	for _, s := range signatures {
+		// signatures that would make a bar or beat 0 ticks long are ignored
+		if s.Denominator > 0 && s.barTicks(ppq) > 0 && s.beatTicks(ppq) > 0 {
+			m.signatures = append(m.signatures, s)
+		}
+	}
+	sort.SliceStable(m.signatures, func(i, j int) bool {
+		return m.signatures[i].Tick < m.signatures[j].Tick
+	})
+	if len(m.signatures) == 0 || m.signatures[0].Tick > 0 {
+		m.signatures = append([]TimeSignature{{Tick: 0, Numerator: 4, Denominator: 4}}, m.signatures...)
+	}
+
+	m.bars = make([]int, len(m.signatures))
+	m.bars[0] = 1
+	for i := 1; i < len(m.signatures); i++ {
+		prev := m.signatures[i-1]
+		length := prev.barTicks(ppq)
+		// a partly played bar still counts as a bar
+		m.bars[i] = m.bars[i-1] + int((m.signatures[i].Tick-prev.Tick+length-1)/length)
+	}
+
+	return m
+}
+
+// tempoAt returns the index of the tempo change that is in effect at tick
+func (m *TempoMap) tempoAt(tick uint64) int {
+	return sort.Search(len(m.tempos), func(i int) bool {
+		return m.tempos[i].Tick > tick
+	}) - 1
+}
+
+// secondsAtIndex converts a tick to seconds using the tempo change at index i,
+// which must be the one in effect at tick
+func (m *TempoMap) secondsAtIndex(i int, tick uint64) float64 {
+	c := m.tempos[i]
+	return m.seconds[i] + float64(tick-c.Tick)*float64(c.MicrosecondsPerQuarter)/1e6/float64(m.PPQ)
+}
+
+func (m *TempoMap) TickToSeconds(tick uint64) float64 {
+	return m.secondsAtIndex(m.tempoAt(tick), tick)
+}
+
+// SecondsToTick returns the tick closest to the given time
+func (m *TempoMap) SecondsToTick(seconds float64) uint64 {
+	if seconds <= 0 {
+		return 0
+	}
+
+	i := sort.Search(len(m.seconds), func(i int) bool {
+		return m.seconds[i] > seconds
+	}) - 1
+	c := m.tempos[i]
+
+	ticks := (seconds - m.seconds[i]) * 1e6 * float64(m.PPQ) / float64(c.MicrosecondsPerQuarter)
+	return c.Tick + uint64(math.Round(ticks))
+}
+
+// signatureAt returns the index of the time signature in effect at tick
+func (m *TempoMap) signatureAt(tick uint64) int {
+	return sort.Search(len(m.signatures), func(i int) bool {
+		return m.signatures[i].Tick > tick
+	}) - 1
+}
+
+func (m *TempoMap) TickToBarBeat(tick uint64) BarBeat {
+	i := m.signatureAt(tick)
+	sig := m.signatures[i]
+
+	rel := tick - sig.Tick
+	bar := rel / sig.barTicks(m.PPQ)
+	inBar := rel % sig.barTicks(m.PPQ)
+
+	return BarBeat{
+		Bar:  m.bars[i] + int(bar),
+		Beat: int(inBar/sig.beatTicks(m.PPQ)) + 1,
+		Tick: int(inBar % sig.beatTicks(m.PPQ)),
+	}
+}
+
+// BarBeatToTick returns the tick of a position, bars before 1 are treated as bar 1
+func (m *TempoMap) BarBeatToTick(pos BarBeat) uint64 {
+	if pos.Bar < 1 {
+		pos.Bar = 1
+	}
+	if pos.Beat < 1 {
+		pos.Beat = 1
+	}
+
+	i := sort.Search(len(m.bars), func(i int) bool {
+		return m.bars[i] > pos.Bar
+	}) - 1
+	sig := m.signatures[i]
+
+	tick := sig.Tick + uint64(pos.Bar-m.bars[i])*sig.barTicks(m.PPQ)
+	tick += uint64(pos.Beat-1) * sig.beatTicks(m.PPQ)
+	if pos.Tick > 0 {
+		tick += uint64(pos.Tick)
+	}
+
+	return tick
+}
+
+// Duration is the playback time from the start of the file to its last event
+func (m *TempoMap) Duration() time.Duration {
+	return time.Duration(m.TickToSeconds(m.EndTick) * float64(time.Second))
+}
+
+// tempoCursor converts increasing ticks to seconds without searching the whole map every time
+type tempoCursor struct {
+	m *TempoMap
+	i int
+}
+
+func (c *tempoCursor) seconds(tick uint64) float64 {
+	if c.i >= len(c.m.tempos) || c.m.tempos[c.i].Tick > tick {
+		c.i = 0
+	}
+	for c.i+1 < len(c.m.tempos) && c.m.tempos[c.i+1].Tick <= tick {
+		c.i++
+	}
+
+	return c.m.secondsAtIndex(c.i, tick)
+}
+
+// tempoFromEvent reads the microseconds per quarter note of a tempo event (ff 51 03 tt tt tt)
+func tempoFromEvent(ev midiEvent) (int, bool) {
+	if ev.status != 0xff || ev.meta != 0x51 || len(ev.data) != 3 {
+		return 0, false
+	}
+
+	return int(ev.data[0])<<16 | int(ev.data[1])<<8 | int(ev.data[2]), true
+}
+
+// timeSignatureFromEvent reads a time signature event (ff 58 04 nn dd cc bb), dd is a power of 2
+func timeSignatureFromEvent(ev midiEvent) (numerator int, denominator int, ok bool) {
+	if ev.status != 0xff || ev.meta != 0x58 || len(ev.data) < 2 || ev.data[1] > 7 {
+		return 0, 0, false
+	}
+
+	return int(ev.data[0]), 1 << ev.data[1], true
+}
+
+// tempoMapFromEvents builds a tempo map from the events of a conductor track
+func tempoMapFromEvents(ppq int, events []timedEvent) *TempoMap {
+	var tempos []TempoChange
+	var signatures []TimeSignature
+	var end uint64
+
+	for _, ev := range events {
+		if tempo, ok := tempoFromEvent(ev.midiEvent); ok {
+			tempos = append(tempos, TempoChange{Tick: ev.tick, MicrosecondsPerQuarter: tempo})
+		}
+		if num, den, ok := timeSignatureFromEvent(ev.midiEvent); ok {
+			signatures = append(signatures, TimeSignature{Tick: ev.tick, Numerator: num, Denominator: den})
+		}
+		if ev.tick > end {
+			end = ev.tick
+		}
+	}
+
+	m := NewTempoMap(ppq, tempos, signatures)
+	m.EndTick = end
+	return m
+}
+
+// ReadTempoMap streams the whole file for the tempo and time signature events of every track
+func ReadTempoMap(path string) (*TempoMap, error) {
+	var tempos []TempoChange
+	var signatures []TimeSignature
+	var end uint64
+	ppq := 0
+
+	err := streamTracks(path, func(header midiHeader, index int, track io.ByteReader) error {
+		if err := checkDivision(path, header); err != nil {
+			return err
+		}
+		ppq = header.division
+
+		var tick uint64
+		er := newEventReader(track)
+		for {
+			ev, err := er.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			tick += uint64(ev.delta)
+			if tempo, ok := tempoFromEvent(ev); ok {
+				tempos = append(tempos, TempoChange{Tick: tick, MicrosecondsPerQuarter: tempo})
+			}
+			if num, den, ok := timeSignatureFromEvent(ev); ok {
+				signatures = append(signatures, TimeSignature{Tick: tick, Numerator: num, Denominator: den})
+			}
+		}
+
+		if tick > end {
+			end = tick
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ppq == 0 {
+		return nil, errors.New("file has no tracks")
+	}
+
+	m := NewTempoMap(ppq, tempos, signatures)
+	m.EndTick = end
+	return m, nil
+}
+
+// MIDIDuration returns how long the file plays for
+func MIDIDuration(path string) (time.Duration, error) {
+	m, err := ReadTempoMap(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.Duration(), nil
+}
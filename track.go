@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// timedEvent is an event at an absolute tick
+// used when tracks have to be changed, not just copied
+type timedEvent struct {
+	tick uint64
+	midiEvent
+}
+
+// decodeTrack reads every event of a track into memory with absolute ticks
+// the end of track event is kept, encodeTrack makes sure there is exactly one
+func decodeTrack(track []byte) ([]timedEvent, error) {
+	var events []timedEvent
+	var tick uint64
+
+	er := newEventReader(bytes.NewReader(track))
+	for {
+		ev, err := er.next()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tick += uint64(ev.delta)
+		ev.data = append([]byte{}, ev.data...) // the reader reuses its buffer
+		events = append(events, timedEvent{tick: tick, midiEvent: ev})
+	}
+}
+
+// eventWriter appends events to track data
+type eventWriter struct {
+	out           []byte
+	runningStatus bool
+	status        byte // last channel status written, 0 after meta and sysex events
+}
+
+// runningStatus leaves out repeated channel status bytes
+func newEventWriter(runningStatus bool) *eventWriter {
+	return &eventWriter{runningStatus: runningStatus}
+}
+
+// write appends the bytes of an event with the given delta time
+func (w *eventWriter) write(delta uint32, ev midiEvent) {
+	w.out = append(w.out, GetVLQBytes(int(delta))...)
+
+	switch {
+	case ev.status == 0xff:
+		// meta and sysex events cancel running status
+		w.status = 0
+		w.out = append(w.out, 0xff, ev.meta)
+		w.out = append(w.out, GetVLQBytes(len(ev.data))...)
+	case ev.status == 0xf0 || ev.status == 0xf7:
+		w.status = 0
+		w.out = append(w.out, ev.status)
+		w.out = append(w.out, GetVLQBytes(len(ev.data))...)
+	default:
+		if !w.runningStatus || ev.status != w.status {
+			w.out = append(w.out, ev.status)
+		}
+		w.status = ev.status
+	}
+
+	w.out = append(w.out, ev.data...)
+}
+
+// writeRaw appends already encoded events, running status starts over after them
+func (w *eventWriter) writeRaw(events []byte) {
+	w.out = append(w.out, events...)
+	w.status = 0
+}
+
+// the largest delta time a VLQ holds (4 bytes), readers reject longer ones
+const maxDeltaTime = 0x0fffffff
+
+// delta returns the delta time from last to tick, a gap too long for one delta time
+// (e.g. after raising the ppq) is split by empty text events so the ticks stay the same
+func (w *eventWriter) delta(last uint64, tick uint64) uint32 {
+	gap := tick - last
+	for gap > maxDeltaTime {
+		w.write(maxDeltaTime, midiEvent{status: 0xff, meta: 0x01})
+		gap -= maxDeltaTime
+	}
+
+	return uint32(gap)
+}
+
+// encodeTrack turns events back into track data
+// events must be sorted by tick. end of track events are dropped and
+// a single one is written after the last event
+func encodeTrack(events []timedEvent, runningStatus bool) []byte {
+	w := newEventWriter(runningStatus)
+	var last uint64 // tick of the last event written
+	var end uint64  // tick of the end of track, a track can end after its last event
+
+	for _, ev := range events {
+		if ev.tick > end {
+			end = ev.tick
+		}
+		if ev.isEndOfTrack() {
+			continue
+		}
+
+		w.write(w.delta(last, ev.tick), ev.midiEvent)
+		last = ev.tick
+	}
+
+	w.write(w.delta(last, end), midiEvent{status: 0xff, meta: 0x2f})
+	return w.out
+}
+
+// sortEvents sorts events by tick, keeping the order of events on the same tick
+func sortEvents(events []timedEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].tick < events[j].tick
+	})
+}
+
+// rescaleTick converts a tick from one resolution (ppq) to another, rounding to the nearest tick
+func rescaleTick(tick uint64, from int, to int) uint64 {
+	return (tick*uint64(to) + uint64(from)/2) / uint64(from)
+}
+
+func rescaleEvents(events []timedEvent, from int, to int) {
+	for i := range events {
+		events[i].tick = rescaleTick(events[i].tick, from, to)
+	}
+}
+
+// rescaleTrack changes the resolution of a whole track
+func rescaleTrack(track []byte, from int, to int, runningStatus bool) ([]byte, error) {
+	if from == to {
+		return track, nil
+	}
+
+	events, err := decodeTrack(track)
+	if err != nil {
+		return nil, err
+	}
+	rescaleEvents(events, from, to)
+
+	return encodeTrack(events, runningStatus), nil
+}
+
+// CompactMIDIFile rewrites every track with running status on or off and logs the size difference
+func CompactMIDIFile(inputPath string, outputPath string, runningStatus bool, logger *Logger) error {
+	file, err := readMIDIFile(inputPath)
+	if err != nil {
+		return err
+	}
+
+	before, after := 0, 0
+	for i, track := range file.tracks {
+		events, err := decodeTrack(track)
+		if err != nil {
+			return fmt.Errorf("track %v: %w", i, err)
+		}
+
+		file.tracks[i] = encodeTrack(events, runningStatus)
+		before += len(track)
+		after += len(file.tracks[i])
+	}
+
+	logger.Infof("track data went from %v to %v bytes", before, after)
+	return file.save(outputPath)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func testEvents() []timedEvent {
+	return []timedEvent{
+		{tick: 0, midiEvent: midiEvent{status: 0xff, meta: 0x03, data: []byte("Art")}},
+		{tick: 0, midiEvent: midiEvent{status: 0xc0, data: []byte{5}}},
+		{tick: 0, midiEvent: midiEvent{status: 0x90, data: []byte{60, 100}}},
+		{tick: 0, midiEvent: midiEvent{status: 0x90, data: []byte{64, 100}}},
+		{tick: 10, midiEvent: midiEvent{status: 0x90, data: []byte{60, 0}}},
+		{tick: 10, midiEvent: midiEvent{status: 0x80, data: []byte{64, 0}}},
+		{tick: 10, midiEvent: midiEvent{status: 0x80, data: []byte{65, 0}}},
+		{tick: 20, midiEvent: midiEvent{status: 0xff, meta: 0x01, data: []byte("marker")}},
+		{tick: 20, midiEvent: midiEvent{status: 0x80, data: []byte{66, 0}}},
+		{tick: 30, midiEvent: midiEvent{status: 0xf0, data: []byte{0x7e, 0x7f, 0x09, 0x01, 0xf7}}},
+		{tick: 30, midiEvent: midiEvent{status: 0xb1, data: []byte{7, 100}}},
+		{tick: 30, midiEvent: midiEvent{status: 0xb1, data: []byte{10, 64}}},
+		{tick: 40, midiEvent: midiEvent{status: 0xe1, data: []byte{0, 64}}},
+		{tick: 40, midiEvent: midiEvent{status: 0xff, meta: 0x2f, data: []byte{}}},
+	}
+}
+
+func TestRunningStatusRoundTrip(t *testing.T) {
+	events := testEvents()
+
+	plain := encodeTrack(events, false)
+	running := encodeTrack(events, true)
+
+	// 0x90 x1, 0x80 x2, 0xb1 x1 left out
+	if len(plain)-len(running) != 4 {
+		t.Errorf("running status saved %v bytes, want 4", len(plain)-len(running))
+	}
+
+	for name, data := range map[string][]byte{"plain": plain, "running": running} {
+		decoded, err := decodeTrack(data)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		// only the ticks matter, the deltas are what was read
+		for i := range decoded {
+			decoded[i].delta = 0
+		}
+		if !reflect.DeepEqual(decoded, events) {
+			t.Errorf("%v: decoded events differ\ngot  %v\nwant %v", name, decoded, events)
+		}
+	}
+
+	// decoding and encoding again gives the same bytes
+	for _, runningStatus := range []bool{false, true} {
+		data := encodeTrack(events, runningStatus)
+		decoded, err := decodeTrack(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again := encodeTrack(decoded, runningStatus); !bytes.Equal(again, data) {
+			t.Errorf("running status %v: bytes changed after a round trip", runningStatus)
+		}
+	}
+}
+
+func TestRunningStatusCancelledByMetaAndSysex(t *testing.T) {
+	data := encodeTrack([]timedEvent{
+		{tick: 0, midiEvent: midiEvent{status: 0x90, data: []byte{60, 100}}},
+		{tick: 0, midiEvent: midiEvent{status: 0xff, meta: 0x01, data: []byte("x")}},
+		{tick: 0, midiEvent: midiEvent{status: 0x90, data: []byte{61, 100}}},
+		{tick: 0, midiEvent: midiEvent{status: 0xf0, data: []byte{0xf7}}},
+		{tick: 0, midiEvent: midiEvent{status: 0x90, data: []byte{62, 100}}},
+	}, true)
+
+	want := []byte{
+		0x00, 0x90, 60, 100,
+		0x00, 0xff, 0x01, 0x01, 'x',
+		0x00, 0x90, 61, 100,
+		0x00, 0xf0, 0x01, 0xf7,
+		0x00, 0x90, 62, 100,
+		0x00, 0xff, 0x2f, 0x00,
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("got  % x\nwant % x", data, want)
+	}
+}
+
+func TestReaderRunningStatus(t *testing.T) {
+	// notes on two channels, each status byte written once
+	data := []byte{
+		0x00, 0x90, 60, 100,
+		0x00, 62, 100,
+		0x10, 60, 0,
+		0x00, 0x81, 62, 0,
+		0x00, 63, 0,
+		0x00, 0xff, 0x2f, 0x00,
+	}
+
+	events, err := decodeTrack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		tick   uint64
+		status byte
+		key    byte
+	}{
+		{0, 0x90, 60}, {0, 0x90, 62}, {16, 0x90, 60}, {16, 0x81, 62}, {16, 0x81, 63},
+	}
+	for i, w := range want {
+		ev := events[i]
+		if ev.tick != w.tick || ev.status != w.status || ev.data[0] != w.key {
+			t.Errorf("event %v: got tick %v status %x key %v, want %v", i, ev.tick, ev.status, ev.data[0], w)
+		}
+	}
+
+	if _, err := decodeTrack([]byte{0x00, 60, 100}); err == nil {
+		t.Error("data byte without a status byte should be an error")
+	}
+}
+
+func TestCreateTrackRunningStatus(t *testing.T) {
+	// a created track has a single channel event, so running status must not change it
+	var plain, running []byte
+
+	createTrack(0, 5, "Art", drumPartSysex("gs", 11), false, &plain)
+	createTrack(0, 5, "Art", drumPartSysex("gs", 11), true, &running)
+
+	if !bytes.Equal(plain, running) {
+		t.Errorf("created track changed with running status\nplain   % x\nrunning % x", plain, running)
+	}
+}
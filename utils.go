@@ -5,6 +5,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 func NumberToBytes(number int, size int) []byte {
@@ -43,9 +46,71 @@ func GetDeltaTimeBytes(input int) []byte {
 
 	wr := new(bytes.Buffer)
 
-	println(fmt.Sprintf("writing metric ticks: %v", ticks))
+	appLog.Debugf("writing metric ticks: %v", ticks)
 
 	binary.Write(wr, binary.BigEndian, uint16(ticks))
 
 	return wr.Bytes()
 }
+
+// GetVLQBytes encodes a number as a MIDI variable length quantity
+// 7 bits per byte, with the high bit set on every byte except the last
+func GetVLQBytes(number int) []byte {
+	bytes := []byte{byte(number & 0x7f)}
+	number >>= 7
+
+	for number > 0 {
+		bytes = append([]byte{byte(number&0x7f) | 0x80}, bytes...)
+		number >>= 7
+	}
+
+	return bytes
+}
+
+// parseIndexList turns a string like "1,3,5-8" into a sorted list of unique indexes
+// indexes past the last track a file can have are rejected before a range is expanded
+func parseIndexList(s string) ([]int, error) {
+	seen := map[int]bool{}
+	var indexes []int
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		min, max := part, part
+		if strings.Contains(part, "-") {
+			split := strings.Split(part, "-")
+			if len(split) != 2 {
+				return nil, fmt.Errorf("range %v must be in the format of <min>-<max>", part)
+			}
+			min, max = split[0], split[1]
+		}
+
+		minInt, err := strconv.Atoi(strings.TrimSpace(min))
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a number", min)
+		}
+		maxInt, err := strconv.Atoi(strings.TrimSpace(max))
+		if err != nil {
+			return nil, fmt.Errorf("%v is not a number", max)
+		}
+		if minInt < 0 || minInt > maxInt {
+			return nil, fmt.Errorf("range %v is not valid", part)
+		}
+		if maxInt >= maxTracks {
+			return nil, fmt.Errorf("index %v is too high, a file has at most %v tracks", maxInt, maxTracks)
+		}
+
+		for i := minInt; i <= maxInt; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indexes = append(indexes, i)
+			}
+		}
+	}
+
+	sort.Ints(indexes)
+	return indexes, nil
+}
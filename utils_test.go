@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestNumberToBytes(t *testing.T) {
+	tests := []struct {
+		number int
+		size   int
+		want   []byte
+	}{
+		{0, 2, []byte{0, 0}},
+		{1, 2, []byte{0, 1}},
+		{255, 1, []byte{0xff}},
+		{256, 2, []byte{1, 0}},
+		{65535, 2, []byte{0xff, 0xff}},
+		{500_000, 3, []byte{0x07, 0xa1, 0x20}},
+		{434_782, 3, []byte{0x06, 0xa2, 0x5e}},
+		{22, 4, []byte{0, 0, 0, 22}},
+	}
+
+	for _, tt := range tests {
+		if got := NumberToBytes(tt.number, tt.size); !bytes.Equal(got, tt.want) {
+			t.Errorf("NumberToBytes(%v, %v) = % x, want % x", tt.number, tt.size, got, tt.want)
+		}
+	}
+}
+
+// every number that fits is written big endian in exactly size bytes
+func TestNumberToBytesBigEndian(t *testing.T) {
+	for n := 0; n < 1<<24; n += 997 {
+		var want [4]byte
+		binary.BigEndian.PutUint32(want[:], uint32(n))
+
+		if got := NumberToBytes(n, 4); !bytes.Equal(got, want[:]) {
+			t.Fatalf("NumberToBytes(%v, 4) = % x, want % x", n, got, want)
+		}
+		if got := NumberToBytes(n, 3); !bytes.Equal(got, want[1:]) {
+			t.Fatalf("NumberToBytes(%v, 3) = % x, want % x", n, got, want[1:])
+		}
+	}
+}
+
+func TestVLQ(t *testing.T) {
+	tests := []struct {
+		number int
+		want   []byte
+	}{
+		{0, []byte{0x00}},
+		{0x40, []byte{0x40}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0x81, 0x00}},
+		{0x2000, []byte{0xc0, 0x00}},
+		{0x3fff, []byte{0xff, 0x7f}},
+		{0x4000, []byte{0x81, 0x80, 0x00}},
+		{0x0fffffff, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+
+	for _, tt := range tests {
+		got := GetVLQBytes(tt.number)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("GetVLQBytes(%#x) = % x, want % x", tt.number, got, tt.want)
+		}
+
+		read, err := readVLQ(bytes.NewReader(got))
+		if err != nil || int(read) != tt.number {
+			t.Errorf("readVLQ(% x) = %#x, %v, want %#x", got, read, err, tt.number)
+		}
+	}
+
+	if _, err := readVLQ(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x00})); err == nil {
+		t.Error("a 5 byte VLQ should be an error")
+	}
+}
+
+func FuzzVLQ(f *testing.F) {
+	f.Add(uint32(0))
+	f.Add(uint32(0x7f))
+	f.Add(uint32(0x80))
+	f.Add(uint32(0x0fffffff))
+
+	f.Fuzz(func(t *testing.T, n uint32) {
+		n &= 0x0fffffff // the largest number a VLQ can hold
+		read, err := readVLQ(bytes.NewReader(GetVLQBytes(int(n))))
+		if err != nil || read != n {
+			t.Errorf("round trip of %#x gave %#x, %v", n, read, err)
+		}
+	})
+}
+
+func TestParseIndexList(t *testing.T) {
+	got, err := parseIndexList("5-7, 1,6")
+	if err != nil || len(got) != 4 || got[0] != 1 || got[3] != 7 {
+		t.Errorf("parseIndexList = %v, %v", got, err)
+	}
+	if got, err := parseIndexList("0-65534"); err != nil || len(got) != maxTracks {
+		t.Errorf("every index of a full file gave %v indexes, %v", len(got), err)
+	}
+
+	// a huge range is rejected instead of expanded
+	for _, s := range []string{"1-2000000000", "65535", "3-1", "-1"} {
+		if _, err := parseIndexList(s); err == nil {
+			t.Errorf("%q should be an error", s)
+		}
+	}
+}